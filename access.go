@@ -0,0 +1,336 @@
+//go:build darwin && !ios
+// +build darwin,!ios
+
+package keychain
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security
+
+#include <stdlib.h>
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+
+// The partition ID authorization isn't declared in the public headers.
+static CFStringRef partitionIDAuthorization() {
+	return CFSTR("ACLAuthorizationPartitionID");
+}
+*/
+import "C"
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"unsafe"
+)
+
+// Access is the access control list for reading the data of a file-based
+// keychain item.
+type Access struct {
+	// Label is the name shown when the user is prompted for access
+	Label string
+	// AllApplications is true if any application can read the item
+	AllApplications bool
+	// TrustedApplications are the paths of the applications that can read
+	// the item without prompting
+	TrustedApplications []string
+	// PartitionIDs are the partitions whose applications can read the item
+	// without prompting, e.g. "teamid:ABCDE12345" for applications signed by
+	// a team, or "apple-tool:" and "apple:" for Apple's. Unlike a path, a
+	// team ID still matches after the application is updated or moved.
+	//
+	// TrustedApplications and PartitionIDs are applied to items added with
+	// Item.SetAccess, and to items added to a keychain created by
+	// NewKeychain with the access. They're read back by GetItemAccess.
+	PartitionIDs []string
+}
+
+// AccessKey is key for kSecAttrAccess
+var AccessKey = attrKey(C.CFTypeRef(C.kSecAttrAccess))
+
+// itemAccess converts an Access for the access attribute.
+type itemAccess struct {
+	access Access
+}
+
+func (a itemAccess) Convert() (C.CFTypeRef, error) {
+	ref, err := a.access.secAccess()
+	if err != nil {
+		return 0, err
+	}
+	return C.CFTypeRef(ref), nil
+}
+
+// SetAccess sets the access control list of a file-based keychain item
+// being added. AllApplications isn't supported.
+func (k *Item) SetAccess(a *Access) {
+	if a != nil {
+		k.attr[AccessKey] = itemAccess{access: *a}
+	} else {
+		delete(k.attr, AccessKey)
+	}
+}
+
+// GetItemAccess returns the access control list of the item matching query,
+// which must be in a file-based keychain. If item is not found returns nil,
+// nil.
+func GetItemAccess(query Item) (*Access, error) {
+	q := query.clone()
+	q.SetMatchLimit(MatchLimitOne)
+	q.SetReturnRef(true)
+	delete(q.attr, ReturnAttributesKey)
+	delete(q.attr, ReturnDataKey)
+	itemRef, err := QueryItemRef(q)
+	if err != nil {
+		return nil, err
+	}
+	if itemRef == 0 {
+		return nil, nil
+	}
+	defer Release(itemRef)
+
+	var accessRef C.SecAccessRef
+	errCode := C.SecKeychainItemCopyAccess(C.SecKeychainItemRef(itemRef), &accessRef) //nolint
+	if err := checkOpError("SecKeychainItemCopyAccess", errCode); err != nil {
+		return nil, err
+	}
+	defer Release(C.CFTypeRef(accessRef))
+	return accessFromSecAccess(accessRef)
+}
+
+// accessFromSecAccess converts the ACLs of accessRef that authorize reading
+// the data.
+func accessFromSecAccess(accessRef C.SecAccessRef) (*Access, error) {
+	var aclList C.CFArrayRef
+	errCode := C.SecAccessCopyACLList(accessRef, &aclList) //nolint
+	if err := checkOpError("SecAccessCopyACLList", errCode); err != nil {
+		return nil, err
+	}
+	defer Release(C.CFTypeRef(aclList))
+
+	access := Access{}
+	for _, acl := range CFArrayToArray(aclList) {
+		if aclAuthorizes(C.SecACLRef(acl), C.CFTypeRef(C.partitionIDAuthorization())) {
+			ids, err := aclPartitionIDs(C.SecACLRef(acl))
+			if err != nil {
+				return nil, err
+			}
+			access.PartitionIDs = append(access.PartitionIDs, ids...)
+			continue
+		}
+		if !aclAuthorizes(C.SecACLRef(acl), C.CFTypeRef(C.kSecACLAuthorizationDecrypt), C.CFTypeRef(C.kSecACLAuthorizationAny)) {
+			continue
+		}
+		var appList C.CFArrayRef
+		var description C.CFStringRef
+		var promptSelector C.SecKeychainPromptSelector
+		errCode := C.SecACLCopyContents(C.SecACLRef(acl), &appList, &description, &promptSelector) //nolint
+		if err := checkOpError("SecACLCopyContents", errCode); err != nil {
+			return nil, err
+		}
+		if description != 0 {
+			access.Label = CFStringToString(description)
+			Release(C.CFTypeRef(description))
+		}
+		if appList == 0 {
+			access.AllApplications = true
+			continue
+		}
+		paths, err := trustedApplicationPaths(appList)
+		Release(C.CFTypeRef(appList))
+		if err != nil {
+			return nil, err
+		}
+		access.TrustedApplications = append(access.TrustedApplications, paths...)
+	}
+	return &access, nil
+}
+
+// aclAuthorizes returns whether acl has any of the authorizations.
+func aclAuthorizes(acl C.SecACLRef, authorizations ...C.CFTypeRef) bool {
+	aclAuthorizations := C.SecACLCopyAuthorizations(acl)
+	if aclAuthorizations == 0 {
+		return false
+	}
+	defer Release(C.CFTypeRef(aclAuthorizations))
+	for _, auth := range CFArrayToArray(aclAuthorizations) {
+		for _, want := range authorizations {
+			if C.CFEqual(auth, want) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// aclPartitionIDs returns the partition IDs of a partition ID ACL, whose
+// description is a hex encoded property list {"Partitions": [ids...]}.
+func aclPartitionIDs(acl C.SecACLRef) ([]string, error) {
+	var appList C.CFArrayRef
+	var description C.CFStringRef
+	var promptSelector C.SecKeychainPromptSelector
+	errCode := C.SecACLCopyContents(acl, &appList, &description, &promptSelector) //nolint
+	if err := checkOpError("SecACLCopyContents", errCode); err != nil {
+		return nil, err
+	}
+	if appList != 0 {
+		Release(C.CFTypeRef(appList))
+	}
+	if description == 0 {
+		return nil, nil
+	}
+	encoded := CFStringToString(description)
+	Release(C.CFTypeRef(description))
+	b, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid partition ID description: %v", err)
+	}
+	cfData, err := BytesToCFData(b)
+	if err != nil {
+		return nil, err
+	}
+	defer Release(C.CFTypeRef(cfData))
+
+	var cfErr C.CFErrorRef
+	plist := C.CFPropertyListCreateWithData(C.kCFAllocatorDefault, cfData, C.kCFPropertyListImmutable, nil, &cfErr)
+	if plist == 0 {
+		if cfErr == 0 {
+			return nil, fmt.Errorf("CFPropertyListCreateWithData failed")
+		}
+		defer Release(C.CFTypeRef(cfErr))
+		return nil, CFErrorError(cfErr)
+	}
+	defer Release(C.CFTypeRef(plist))
+	v, err := Convert(C.CFTypeRef(plist))
+	if err != nil {
+		return nil, err
+	}
+	m, _ := v.(map[interface{}]interface{})
+	partitions, _ := m["Partitions"].([]interface{})
+	ids := make([]string, 0, len(partitions))
+	for _, p := range partitions {
+		if id, ok := p.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// partitionIDsDescription returns the description of a partition ID ACL for
+// ids, which must be released with Release(ref).
+func partitionIDsDescription(ids []string) (C.CFStringRef, error) {
+	refs := make([]C.CFTypeRef, 0, len(ids))
+	for _, id := range ids {
+		ref, err := StringToCFString(id)
+		if err != nil {
+			return 0, err
+		}
+		defer Release(C.CFTypeRef(ref))
+		refs = append(refs, C.CFTypeRef(ref))
+	}
+	partitions := ArrayToCFArray(refs)
+	defer Release(C.CFTypeRef(partitions))
+	dict, err := ConvertMapToCFDictionary(map[string]interface{}{"Partitions": C.CFTypeRef(partitions)})
+	if err != nil {
+		return 0, err
+	}
+	defer Release(C.CFTypeRef(dict))
+
+	var cfErr C.CFErrorRef
+	cfData := C.CFPropertyListCreateData(C.kCFAllocatorDefault, C.CFPropertyListRef(dict), C.kCFPropertyListXMLFormat_v1_0, 0, &cfErr)
+	if cfData == 0 {
+		if cfErr == 0 {
+			return 0, fmt.Errorf("CFPropertyListCreateData failed")
+		}
+		defer Release(C.CFTypeRef(cfErr))
+		return 0, CFErrorError(cfErr)
+	}
+	defer Release(C.CFTypeRef(cfData))
+	b, err := CFDataToBytes(cfData)
+	if err != nil {
+		return 0, err
+	}
+	return StringToCFString(hex.EncodeToString(b))
+}
+
+// addPartitionIDs adds an ACL to access trusting the applications in the
+// partitions.
+func addPartitionIDs(access C.SecAccessRef, ids []string) error {
+	description, err := partitionIDsDescription(ids)
+	if err != nil {
+		return err
+	}
+	defer Release(C.CFTypeRef(description))
+
+	var acl C.SecACLRef
+	errCode := C.SecACLCreateWithSimpleContents(access, 0, description, 0, &acl) //nolint
+	if err := checkOpError("SecACLCreateWithSimpleContents", errCode); err != nil {
+		return err
+	}
+	defer Release(C.CFTypeRef(acl))
+	authorizations := ArrayToCFArray([]C.CFTypeRef{C.CFTypeRef(C.partitionIDAuthorization())})
+	defer Release(C.CFTypeRef(authorizations))
+	return checkOpError("SecACLUpdateAuthorizations", C.SecACLUpdateAuthorizations(acl, authorizations)) //nolint
+}
+
+func trustedApplicationPaths(appList C.CFArrayRef) ([]string, error) {
+	apps := CFArrayToArray(appList)
+	paths := make([]string, 0, len(apps))
+	for _, app := range apps {
+		var cfData C.CFDataRef
+		errCode := C.SecTrustedApplicationCopyData(C.SecTrustedApplicationRef(app), &cfData) //nolint
+		if err := checkOpError("SecTrustedApplicationCopyData", errCode); err != nil {
+			return nil, err
+		}
+		if cfData == 0 {
+			return nil, fmt.Errorf("SecTrustedApplicationCopyData returned no data")
+		}
+		b, err := CFDataToBytes(cfData)
+		Release(C.CFTypeRef(cfData))
+		if err != nil {
+			return nil, err
+		}
+		// The data is a NUL terminated path.
+		paths = append(paths, string(bytes.TrimRight(b, "\x00")))
+	}
+	return paths, nil
+}
+
+// secAccess creates a SecAccessRef trusting the access's applications and
+// partitions, which must be released with Release(ref).
+func (a *Access) secAccess() (C.SecAccessRef, error) {
+	if a.AllApplications {
+		return 0, fmt.Errorf("creating access for all applications is not supported")
+	}
+	label, err := StringToCFString(a.Label)
+	if err != nil {
+		return 0, err
+	}
+	defer Release(C.CFTypeRef(label))
+
+	apps := make([]C.CFTypeRef, 0, len(a.TrustedApplications))
+	for _, path := range a.TrustedApplications {
+		cPath := C.CString(path)
+		var app C.SecTrustedApplicationRef
+		errCode := C.SecTrustedApplicationCreateFromPath(cPath, &app) //nolint
+		C.free(unsafe.Pointer(cPath))
+		if err := checkOpError("SecTrustedApplicationCreateFromPath", errCode); err != nil {
+			return 0, err
+		}
+		defer Release(C.CFTypeRef(app))
+		apps = append(apps, C.CFTypeRef(app))
+	}
+	trustedList := ArrayToCFArray(apps)
+	defer Release(C.CFTypeRef(trustedList))
+
+	var access C.SecAccessRef
+	if err := checkOpError("SecAccessCreate", C.SecAccessCreate(label, trustedList, &access)); err != nil { //nolint
+		return 0, err
+	}
+	if len(a.PartitionIDs) > 0 {
+		if err := addPartitionIDs(access, a.PartitionIDs); err != nil {
+			Release(C.CFTypeRef(access))
+			return 0, err
+		}
+	}
+	return access, nil
+}
@@ -0,0 +1,250 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security
+
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+
+static CFTypeRef CFDictionaryGetValueSafe(CFDictionaryRef theDict, CFTypeRef key) {
+  return CFDictionaryGetValue(theDict, key);
+}
+*/
+import "C"
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// CertificateRef wraps a SecCertificateRef. The underlying reference is
+// released when the CertificateRef is garbage collected.
+type CertificateRef struct {
+	ref C.SecCertificateRef
+}
+
+// newCertificateRef retains ref and wraps it in a CertificateRef.
+func newCertificateRef(ref C.SecCertificateRef) *CertificateRef {
+	C.CFRetain(C.CFTypeRef(ref))
+	trackCF(C.CFTypeRef(ref))
+	c := &CertificateRef{ref: ref}
+	runtime.SetFinalizer(c, func(c *CertificateRef) {
+		Release(C.CFTypeRef(c.ref))
+	})
+	return c
+}
+
+// Close releases the underlying reference instead of waiting for the
+// CertificateRef to be garbage collected. It's safe to call more than once,
+// but the CertificateRef must not be used after it's closed.
+func (c *CertificateRef) Close() {
+	if c.ref == 0 {
+		return
+	}
+	runtime.SetFinalizer(c, nil)
+	Release(C.CFTypeRef(c.ref))
+	c.ref = 0
+}
+
+// NewCertificateRef creates a CertificateRef from DER encoded certificate data.
+func NewCertificateRef(der []byte) (*CertificateRef, error) {
+	cfData, err := BytesToCFData(der)
+	if err != nil {
+		return nil, err
+	}
+	defer Release(C.CFTypeRef(cfData))
+	ref := C.SecCertificateCreateWithData(C.kCFAllocatorDefault, cfData)
+	if ref == 0 {
+		return nil, fmt.Errorf("SecCertificateCreateWithData failed")
+	}
+	trackCF(C.CFTypeRef(ref))
+	defer Release(C.CFTypeRef(ref))
+	return newCertificateRef(ref), nil
+}
+
+// CertificateFromX509 creates a CertificateRef from an x509.Certificate.
+func CertificateFromX509(cert *x509.Certificate) (*CertificateRef, error) {
+	return NewCertificateRef(cert.Raw)
+}
+
+// X509 parses the certificate into an x509.Certificate.
+func (c *CertificateRef) X509() (*x509.Certificate, error) {
+	der, err := c.Data()
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Data returns the DER encoded certificate data.
+func (c *CertificateRef) Data() ([]byte, error) {
+	cfData := C.SecCertificateCopyData(c.ref)
+	if cfData == 0 {
+		return nil, fmt.Errorf("SecCertificateCopyData failed")
+	}
+	defer Release(C.CFTypeRef(cfData))
+	return CFDataToBytes(cfData)
+}
+
+// CertificatesData returns the DER encoded data of each certificate.
+func CertificatesData(certs []*CertificateRef) ([][]byte, error) {
+	data := make([][]byte, 0, len(certs))
+	for _, cert := range certs {
+		der, err := cert.Data()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, der)
+	}
+	return data, nil
+}
+
+// CommonName returns the common name of the certificate subject.
+func (c *CertificateRef) CommonName() (string, error) {
+	var cfStr C.CFStringRef
+	errCode := C.SecCertificateCopyCommonName(c.ref, &cfStr) //nolint
+	if err := checkOpError("SecCertificateCopyCommonName", errCode); err != nil {
+		return "", err
+	}
+	if cfStr == 0 {
+		return "", nil
+	}
+	defer Release(C.CFTypeRef(cfStr))
+	return CFStringToString(cfStr), nil
+}
+
+// SubjectSummary returns a human readable summary of the certificate subject.
+func (c *CertificateRef) SubjectSummary() string {
+	cfStr := C.SecCertificateCopySubjectSummary(c.ref)
+	if cfStr == 0 {
+		return ""
+	}
+	defer Release(C.CFTypeRef(cfStr))
+	return CFStringToString(cfStr)
+}
+
+// SerialNumber returns the DER encoded serial number of the certificate.
+func (c *CertificateRef) SerialNumber() ([]byte, error) {
+	cfData := C.SecCertificateCopySerialNumberData(c.ref, nil)
+	if cfData == 0 {
+		return nil, fmt.Errorf("SecCertificateCopySerialNumberData failed")
+	}
+	defer Release(C.CFTypeRef(cfData))
+	return CFDataToBytes(cfData)
+}
+
+// EmailAddresses returns the email addresses in the certificate.
+func (c *CertificateRef) EmailAddresses() ([]string, error) {
+	var cfArray C.CFArrayRef
+	errCode := C.SecCertificateCopyEmailAddresses(c.ref, &cfArray) //nolint
+	if err := checkOpError("SecCertificateCopyEmailAddresses", errCode); err != nil {
+		return nil, err
+	}
+	if cfArray == 0 {
+		return nil, nil
+	}
+	defer Release(C.CFTypeRef(cfArray))
+	arr := CFArrayToArray(cfArray)
+	emails := make([]string, 0, len(arr))
+	for _, ref := range arr {
+		emails = append(emails, CFStringToString(C.CFStringRef(ref)))
+	}
+	return emails, nil
+}
+
+// PublicKey returns the public key of the certificate. RSA and ECDSA keys
+// are supported.
+func (c *CertificateRef) PublicKey() (crypto.PublicKey, error) {
+	key := C.SecCertificateCopyKey(c.ref)
+	if key == 0 {
+		return nil, fmt.Errorf("SecCertificateCopyKey failed")
+	}
+	defer Release(C.CFTypeRef(key))
+
+	attrs := C.SecKeyCopyAttributes(key)
+	if attrs == 0 {
+		return nil, fmt.Errorf("SecKeyCopyAttributes failed")
+	}
+	defer Release(C.CFTypeRef(attrs))
+	keyType := C.CFDictionaryGetValueSafe(attrs, C.CFTypeRef(C.kSecAttrKeyType))
+	if keyType == 0 {
+		return nil, fmt.Errorf("missing key type")
+	}
+
+	var cfErr C.CFErrorRef
+	cfData := C.SecKeyCopyExternalRepresentation(key, &cfErr) //nolint
+	if cfData == 0 {
+		if cfErr == 0 {
+			return nil, fmt.Errorf("SecKeyCopyExternalRepresentation failed")
+		}
+		defer Release(C.CFTypeRef(cfErr))
+		return nil, CFErrorError(cfErr)
+	}
+	defer Release(C.CFTypeRef(cfData))
+	b, err := CFDataToBytes(cfData)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case C.CFEqual(keyType, C.CFTypeRef(C.kSecAttrKeyTypeRSA)) != 0:
+		// RSA keys are exported in PKCS #1 format.
+		return x509.ParsePKCS1PublicKey(b)
+	case C.CFEqual(keyType, C.CFTypeRef(C.kSecAttrKeyTypeECSECPrimeRandom)) != 0:
+		// EC keys are exported in ANSI X9.63 format: 04 || X || Y, so the
+		// length determines the curve.
+		var curve elliptic.Curve
+		switch len(b) {
+		case 65:
+			curve = elliptic.P256()
+		case 97:
+			curve = elliptic.P384()
+		case 133:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC key size")
+		}
+		x, y := elliptic.Unmarshal(curve, b) //nolint
+		if x == nil {
+			return nil, fmt.Errorf("invalid EC public key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type: %s", CFStringToString(C.CFStringRef(keyType)))
+}
+
+// DNSNames returns the DNS subject alternative names of the certificate.
+// Security.framework doesn't expose subject alternative names or validity
+// dates on all supported OS versions, so these are read via X509.
+func (c *CertificateRef) DNSNames() ([]string, error) {
+	cert, err := c.X509()
+	if err != nil {
+		return nil, err
+	}
+	return cert.DNSNames, nil
+}
+
+// NotBefore returns the start of the certificate validity period.
+func (c *CertificateRef) NotBefore() (time.Time, error) {
+	cert, err := c.X509()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotBefore, nil
+}
+
+// NotAfter returns the end of the certificate validity period.
+func (c *CertificateRef) NotAfter() (time.Time, error) {
+	cert, err := c.X509()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
@@ -0,0 +1,113 @@
+//go:build darwin && !ios
+// +build darwin,!ios
+
+package keychain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testCertificateDER(t *testing.T) []byte {
+	return testCertificateDERWithCurve(t, elliptic.P256())
+}
+
+func testCertificateDERWithCurve(t *testing.T, curve elliptic.Curve) []byte {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1234),
+		Subject:        pkix.Name{CommonName: "go-keychain test"},
+		NotBefore:      time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:       time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		DNSNames:       []string{"keychain.example.com"},
+		EmailAddresses: []string{"test@example.com"},
+
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return der
+}
+
+func TestCertificateRefMetadata(t *testing.T) {
+	der := testCertificateDER(t)
+	cert, err := NewCertificateRef(der)
+	require.NoError(t, err)
+
+	data, err := cert.Data()
+	require.NoError(t, err)
+	require.Equal(t, der, data)
+
+	cn, err := cert.CommonName()
+	require.NoError(t, err)
+	require.Equal(t, "go-keychain test", cn)
+	require.Equal(t, "go-keychain test", cert.SubjectSummary())
+
+	serial, err := cert.SerialNumber()
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(1234).Bytes(), serial)
+
+	emails, err := cert.EmailAddresses()
+	require.NoError(t, err)
+	require.Equal(t, []string{"test@example.com"}, emails)
+
+	dnsNames, err := cert.DNSNames()
+	require.NoError(t, err)
+	require.Equal(t, []string{"keychain.example.com"}, dnsNames)
+
+	notBefore, err := cert.NotBefore()
+	require.NoError(t, err)
+	require.True(t, notBefore.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)))
+	notAfter, err := cert.NotAfter()
+	require.NoError(t, err)
+	require.True(t, notAfter.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestCertificateRefX509(t *testing.T) {
+	der := testCertificateDER(t)
+	parsed, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	cert, err := CertificateFromX509(parsed)
+	require.NoError(t, err)
+	converted, err := cert.X509()
+	require.NoError(t, err)
+	require.True(t, parsed.Equal(converted))
+}
+
+func TestCertificateRefPublicKey(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		der := testCertificateDERWithCurve(t, curve)
+		parsed, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+
+		cert, err := NewCertificateRef(der)
+		require.NoError(t, err)
+		pub, err := cert.PublicKey()
+		require.NoError(t, err)
+		require.True(t, parsed.PublicKey.(*ecdsa.PublicKey).Equal(pub), curve.Params().Name)
+	}
+}
+
+func TestCertificateRefClose(t *testing.T) {
+	EnableLeakDetection()
+	defer DisableLeakDetection()
+
+	cert, err := NewCertificateRef(testCertificateDER(t))
+	require.NoError(t, err)
+	require.NotEmpty(t, OutstandingCFObjects())
+	cert.Close()
+	cert.Close()
+	require.Empty(t, OutstandingCFObjects())
+}
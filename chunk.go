@@ -0,0 +1,81 @@
+package keychain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// chunkMagic starts the manifest stored in place of chunked data.
+var chunkMagic = []byte("GKCHUNK1")
+
+// chunkManifestLen is the length of an encoded chunkManifest: the magic,
+// chunk count, data length and SHA-256 of the data.
+var chunkManifestLen = len(chunkMagic) + 4 + 8 + sha256.Size
+
+// chunkManifest describes data split across chunk items.
+type chunkManifest struct {
+	count  int
+	length int
+	sum    [sha256.Size]byte
+}
+
+func newChunkManifest(data []byte, chunkSize int) chunkManifest {
+	return chunkManifest{
+		count:  (len(data) + chunkSize - 1) / chunkSize,
+		length: len(data),
+		sum:    sha256.Sum256(data),
+	}
+}
+
+func (m chunkManifest) encode() []byte {
+	b := make([]byte, 0, chunkManifestLen)
+	b = append(b, chunkMagic...)
+	b = binary.BigEndian.AppendUint32(b, uint32(m.count))
+	b = binary.BigEndian.AppendUint64(b, uint64(m.length))
+	return append(b, m.sum[:]...)
+}
+
+func decodeChunkManifest(b []byte) (chunkManifest, error) {
+	if len(b) != chunkManifestLen || !bytes.HasPrefix(b, chunkMagic) {
+		return chunkManifest{}, fmt.Errorf("item data is not a chunk manifest")
+	}
+	b = b[len(chunkMagic):]
+	m := chunkManifest{
+		count:  int(binary.BigEndian.Uint32(b)),
+		length: int(binary.BigEndian.Uint64(b[4:])),
+	}
+	copy(m.sum[:], b[12:])
+	return m, nil
+}
+
+// verify checks that data matches the manifest.
+func (m chunkManifest) verify(data []byte) error {
+	if len(data) != m.length {
+		return fmt.Errorf("chunked data is %d bytes, expected %d", len(data), m.length)
+	}
+	if sha256.Sum256(data) != m.sum {
+		return fmt.Errorf("chunked data checksum mismatch")
+	}
+	return nil
+}
+
+// splitChunks splits data into chunks of at most chunkSize bytes. The chunks
+// share data's memory.
+func splitChunks(data []byte, chunkSize int) [][]byte {
+	chunks := make([][]byte, 0, (len(data)+chunkSize-1)/chunkSize)
+	for len(data) > chunkSize {
+		chunks = append(chunks, data[:chunkSize])
+		data = data[chunkSize:]
+	}
+	if len(data) > 0 {
+		chunks = append(chunks, data)
+	}
+	return chunks
+}
+
+// chunkAccount is the account of the i'th chunk item of account.
+func chunkAccount(account string, i int) string {
+	return fmt.Sprintf("%s#chunk%d", account, i)
+}
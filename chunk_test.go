@@ -0,0 +1,31 @@
+package keychain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkManifest(t *testing.T) {
+	data := bytes.Repeat([]byte("toomanysecrets"), 10)
+	chunks := splitChunks(data, 32)
+	require.Len(t, chunks, 5)
+	require.Equal(t, data, bytes.Join(chunks, nil))
+
+	m := newChunkManifest(data, 32)
+	require.Equal(t, 5, m.count)
+	decoded, err := decodeChunkManifest(m.encode())
+	require.NoError(t, err)
+	require.Equal(t, m, decoded)
+	require.NoError(t, decoded.verify(data))
+
+	corrupt := append([]byte{}, data...)
+	corrupt[0] ^= 1
+	require.Error(t, decoded.verify(corrupt))
+	require.Error(t, decoded.verify(data[1:]))
+
+	_, err = decodeChunkManifest(data)
+	require.Error(t, err)
+	require.Empty(t, splitChunks(nil, 32))
+}
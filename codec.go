@@ -0,0 +1,37 @@
+package keychain
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// codecVersionJSON is the version byte prefixed to data encoded by
+// EncodeJSON.
+const codecVersionJSON byte = 1
+
+// EncodeJSON encodes v as JSON prefixed with a version byte, for storing
+// structured secrets as item data.
+func EncodeJSON(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{codecVersionJSON}, b...), nil
+}
+
+// DecodeJSON decodes data encoded by EncodeJSON into v. Fields unknown to v
+// are ignored, so data written by newer versions of a struct can be read by
+// older ones. Plain JSON without a version byte, as written by hand-rolled
+// code, is also accepted.
+func DecodeJSON(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return fmt.Errorf("no data to decode")
+	}
+	switch data[0] {
+	case codecVersionJSON:
+		return json.Unmarshal(data[1:], v)
+	case '{', '[', '"':
+		return json.Unmarshal(data, v)
+	}
+	return fmt.Errorf("unsupported codec version %d", data[0])
+}
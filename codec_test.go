@@ -0,0 +1,32 @@
+package keychain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecJSON(t *testing.T) {
+	type v1 struct {
+		Token string
+	}
+	type v2 struct {
+		Token   string
+		Refresh string
+	}
+
+	data, err := EncodeJSON(v2{Token: "token", Refresh: "refresh"})
+	require.NoError(t, err)
+	require.Equal(t, codecVersionJSON, data[0])
+
+	var older v1
+	require.NoError(t, DecodeJSON(data, &older))
+	require.Equal(t, v1{Token: "token"}, older)
+
+	var plain v1
+	require.NoError(t, DecodeJSON([]byte(`{"Token":"plain"}`), &plain))
+	require.Equal(t, v1{Token: "plain"}, plain)
+
+	require.Error(t, DecodeJSON(nil, &plain))
+	require.Error(t, DecodeJSON([]byte{99, '{', '}'}, &plain))
+}
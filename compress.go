@@ -0,0 +1,89 @@
+package keychain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// CompressedDataType is the type attribute SetCompressedData sets on items
+// whose data it compressed, so queries know to decompress it.
+const CompressedDataType FourCharCode = 0x474b677a // 'GKgz'
+
+// CompressData gzip compresses data if it's at least threshold bytes and
+// compressing makes it smaller, returning whether it did. Otherwise data is
+// returned unchanged.
+func CompressData(data []byte, threshold int) (compressed []byte, ok bool, err error) {
+	if len(data) < threshold {
+		return data, false, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, false, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, false, err
+	}
+	if buf.Len() >= len(data) {
+		return data, false, nil
+	}
+	return buf.Bytes(), true, nil
+}
+
+// DecompressData decompresses data compressed by CompressData.
+func DecompressData(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// decompressDataWiping decompresses data compressed by CompressData, wiping
+// the buffers used while decompressing so the returned slice is the only copy
+// of the plaintext in Go memory.
+func decompressDataWiping(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	defer scrubGzipReader(zr)
+	return readAllWiping(zr)
+}
+
+// readAllWiping is io.ReadAll, but wipes each buffer it outgrows.
+func readAllWiping(r io.Reader) ([]byte, error) {
+	b := make([]byte, 0, 512)
+	for {
+		if len(b) == cap(b) {
+			grown := make([]byte, len(b), 2*cap(b))
+			copy(grown, b)
+			Wipe(b)
+			b = grown
+		}
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			Wipe(b)
+			return nil, err
+		}
+	}
+}
+
+// scrubGzipReader overwrites the decompressed data zr keeps in its history
+// window (the last 32 KiB of output) by decompressing as many zeros with it.
+func scrubGzipReader(zr *gzip.Reader) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(make([]byte, 1<<15))
+	_ = zw.Close()
+	if err := zr.Reset(&buf); err == nil {
+		_, _ = io.Copy(io.Discard, zr)
+	}
+}
@@ -0,0 +1,44 @@
+package keychain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressData(t *testing.T) {
+	small := []byte("toomanysecrets")
+	compressed, ok, err := CompressData(small, 1024)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, small, compressed)
+
+	large := bytes.Repeat([]byte("toomanysecrets"), 1000)
+	compressed, ok, err = CompressData(large, 1024)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Less(t, len(compressed), len(large))
+
+	decompressed, err := DecompressData(compressed)
+	require.NoError(t, err)
+	require.Equal(t, large, decompressed)
+
+	_, err = DecompressData(small)
+	require.Error(t, err)
+	_, err = DecompressData(append(compressed[:len(compressed)-8:len(compressed)-8], 0, 0))
+	require.Error(t, err)
+}
+
+func TestDecompressDataWiping(t *testing.T) {
+	for _, n := range []int{100, 1 << 16} {
+		large := bytes.Repeat([]byte("toomanysecrets"), n)
+		compressed, ok, err := CompressData(large, 1024)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		decompressed, err := decompressDataWiping(compressed)
+		require.NoError(t, err)
+		require.Equal(t, large, decompressed)
+	}
+}
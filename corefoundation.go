@@ -33,12 +33,16 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sort"
+	"sync"
+	"time"
 	"unicode/utf8"
 	"unsafe"
 )
 
 // Release releases memory pointed to by a CFTypeRef.
 func Release(ref C.CFTypeRef) {
+	untrackCF(ref)
 	C.CFRelease(ref)
 }
 
@@ -56,6 +60,7 @@ func BytesToCFData(b []byte) (C.CFDataRef, error) {
 	if cfData == 0 {
 		return 0, fmt.Errorf("CFDataCreate failed")
 	}
+	trackCF(C.CFTypeRef(cfData))
 	return cfData, nil
 }
 
@@ -64,6 +69,16 @@ func CFDataToBytes(cfData C.CFDataRef) ([]byte, error) {
 	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(cfData)), C.int(C.CFDataGetLength(cfData))), nil
 }
 
+// borrowCFDataBytes returns the bytes of cfData without copying them. The
+// slice is only valid while cfData is alive and must not be modified.
+func borrowCFDataBytes(cfData C.CFDataRef) []byte {
+	length := C.CFDataGetLength(cfData)
+	if length == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(C.CFDataGetBytePtr(cfData))), int(length))
+}
+
 // MapToCFDictionary will return a CFDictionaryRef and if non-nil, must be
 // released with Release(ref).
 func MapToCFDictionary(m map[C.CFTypeRef]C.CFTypeRef) (C.CFDictionaryRef, error) {
@@ -83,20 +98,30 @@ func MapToCFDictionary(m map[C.CFTypeRef]C.CFTypeRef) (C.CFDictionaryRef, error)
 	if cfDict == 0 {
 		return 0, fmt.Errorf("CFDictionaryCreate failed")
 	}
+	trackCF(C.CFTypeRef(cfDict))
 	return cfDict, nil
 }
 
 // CFDictionaryToMap converts CFDictionaryRef to a map.
 func CFDictionaryToMap(cfDict C.CFDictionaryRef) (m map[C.CFTypeRef]C.CFTypeRef) {
+	keys, values := cfDictionaryKeysAndValues(cfDict)
+	if len(keys) > 0 {
+		m = make(map[C.CFTypeRef]C.CFTypeRef, len(keys))
+		for i, key := range keys {
+			m[key] = values[i]
+		}
+	}
+	return
+}
+
+// cfDictionaryKeysAndValues returns the keys and corresponding values of
+// cfDict, without building a map.
+func cfDictionaryKeysAndValues(cfDict C.CFDictionaryRef) (keys []C.CFTypeRef, values []C.CFTypeRef) {
 	count := C.CFDictionaryGetCount(cfDict)
 	if count > 0 {
-		keys := make([]C.CFTypeRef, count)
-		values := make([]C.CFTypeRef, count)
+		keys = make([]C.CFTypeRef, count)
+		values = make([]C.CFTypeRef, count)
 		C.CFDictionaryGetKeysAndValues(cfDict, (*unsafe.Pointer)(unsafe.Pointer(&keys[0])), (*unsafe.Pointer)(unsafe.Pointer(&values[0])))
-		m = make(map[C.CFTypeRef]C.CFTypeRef, count)
-		for i := C.CFIndex(0); i < count; i++ {
-			m[keys[i]] = values[i]
-		}
 	}
 	return
 }
@@ -105,7 +130,82 @@ func CFDictionaryToMap(cfDict C.CFDictionaryRef) (m map[C.CFTypeRef]C.CFTypeRef)
 func Int32ToCFNumber(u int32) C.CFNumberRef {
 	sint := C.SInt32(u)
 	p := unsafe.Pointer(&sint)
-	return C.CFNumberCreate(C.kCFAllocatorDefault, C.kCFNumberSInt32Type, p)
+	cfNumber := C.CFNumberCreate(C.kCFAllocatorDefault, C.kCFNumberSInt32Type, p)
+	trackCF(C.CFTypeRef(cfNumber))
+	return cfNumber
+}
+
+// Int64ToCFNumber will return a CFNumberRef, must be released with Release(ref).
+func Int64ToCFNumber(i int64) C.CFNumberRef {
+	sint := C.SInt64(i)
+	cfNumber := C.CFNumberCreate(C.kCFAllocatorDefault, C.kCFNumberSInt64Type, unsafe.Pointer(&sint))
+	trackCF(C.CFTypeRef(cfNumber))
+	return cfNumber
+}
+
+// Float64ToCFNumber will return a CFNumberRef, must be released with Release(ref).
+func Float64ToCFNumber(f float64) C.CFNumberRef {
+	float := C.Float64(f)
+	cfNumber := C.CFNumberCreate(C.kCFAllocatorDefault, C.kCFNumberFloat64Type, unsafe.Pointer(&float))
+	trackCF(C.CFTypeRef(cfNumber))
+	return cfNumber
+}
+
+// NumberToCFNumber converts a Go integer or floating point value to a
+// CFNumberRef, which must be released with Release(ref). Unsigned values
+// larger than math.MaxInt64 can't be represented.
+func NumberToCFNumber(v interface{}) (C.CFNumberRef, error) {
+	switch val := v.(type) {
+	case int:
+		return Int64ToCFNumber(int64(val)), nil
+	case int8:
+		return Int64ToCFNumber(int64(val)), nil
+	case int16:
+		return Int64ToCFNumber(int64(val)), nil
+	case int32:
+		return Int32ToCFNumber(val), nil
+	case int64:
+		return Int64ToCFNumber(val), nil
+	case uint:
+		return NumberToCFNumber(uint64(val))
+	case uint8:
+		return Int64ToCFNumber(int64(val)), nil
+	case uint16:
+		return Int64ToCFNumber(int64(val)), nil
+	case uint32:
+		return Int64ToCFNumber(int64(val)), nil
+	case uint64:
+		if val > math.MaxInt64 {
+			return 0, fmt.Errorf("Number is too large: %d", val)
+		}
+		return Int64ToCFNumber(int64(val)), nil
+	case float32:
+		return Float64ToCFNumber(float64(val)), nil
+	case float64:
+		return Float64ToCFNumber(val), nil
+	}
+	return 0, fmt.Errorf("Unsupported number type: %T", v)
+}
+
+// CFNumberToInt64 returns the value of an integer CFNumberRef. Returns false
+// if the number is a floating point number or doesn't fit in an int64.
+func CFNumberToInt64(cfNumber C.CFNumberRef) (int64, bool) {
+	if C.CFNumberIsFloatType(cfNumber) != 0 {
+		return 0, false
+	}
+	var sint C.SInt64
+	if C.CFNumberGetValue(cfNumber, C.kCFNumberSInt64Type, unsafe.Pointer(&sint)) == 0 { //nolint
+		return 0, false
+	}
+	return int64(sint), true
+}
+
+// CFNumberToFloat64 returns the value of a CFNumberRef as a float64, which
+// may lose precision for large integers.
+func CFNumberToFloat64(cfNumber C.CFNumberRef) float64 {
+	var float C.Float64
+	C.CFNumberGetValue(cfNumber, C.kCFNumberFloat64Type, unsafe.Pointer(&float)) //nolint
+	return float64(float)
 }
 
 // StringToCFString will return a CFStringRef and if non-nil, must be released with
@@ -123,7 +223,9 @@ func StringToCFString(s string) (C.CFStringRef, error) {
 	if len(bytes) > 0 {
 		p = (*C.UInt8)(&bytes[0])
 	}
-	return C.CFStringCreateWithBytes(C.kCFAllocatorDefault, p, C.CFIndex(len(s)), C.kCFStringEncodingUTF8, C.false), nil
+	cfStr := C.CFStringCreateWithBytes(C.kCFAllocatorDefault, p, C.CFIndex(len(s)), C.kCFStringEncodingUTF8, C.false)
+	trackCF(C.CFTypeRef(cfStr))
+	return cfStr, nil
 }
 
 // CFStringToString converts a CFStringRef to a string.
@@ -158,7 +260,9 @@ func ArrayToCFArray(a []C.CFTypeRef) C.CFArrayRef {
 	if numValues > 0 {
 		valuesPointer = &values[0]
 	}
-	return C.CFArrayCreateSafe2(C.kCFAllocatorDefault, valuesPointer, C.CFIndex(numValues), &C.kCFTypeArrayCallBacks) //nolint
+	cfArray := C.CFArrayCreateSafe2(C.kCFAllocatorDefault, valuesPointer, C.CFIndex(numValues), &C.kCFTypeArrayCallBacks) //nolint
+	trackCF(C.CFTypeRef(cfArray))
+	return cfArray
 }
 
 // CFArrayToArray converts a CFArrayRef to an array of CFTypes.
@@ -171,66 +275,199 @@ func CFArrayToArray(cfArray C.CFArrayRef) (a []C.CFTypeRef) {
 	return
 }
 
-// Convertable knows how to convert an instance to a CFTypeRef.
+// CFTypeRef is a Core Foundation object reference. Packages using cgo can
+// convert their own C.CFTypeRef to it with CFTypeRef(uintptr(ref)).
+type CFTypeRef = C.CFTypeRef
+
+// Convertable knows how to convert an instance to a CFTypeRef, so it can be
+// used as an Item attribute value (see Item.SetConvertable).
+//
+// Convert is called each time the item is converted to a CFDictionary, and
+// must return a reference the caller owns: a new object from a Create or
+// Copy function, or an existing one retained with CFRetain. The reference is
+// released with Release once the dictionary is built, which retains it for
+// as long as it needs it. If Convert returns an error, the operation fails
+// with that error.
 type Convertable interface {
-	Convert() (C.CFTypeRef, error)
+	Convert() (CFTypeRef, error)
+}
+
+// cfDictBuilder holds the buffers used by ConvertMapToCFDictionary, which are
+// pooled so repeated queries don't allocate them again.
+type cfDictBuilder struct {
+	names   []string
+	keys    []C.uintptr_t
+	values  []C.uintptr_t
+	release []C.CFTypeRef
+}
+
+var cfDictBuilderPool = sync.Pool{
+	New: func() interface{} { return &cfDictBuilder{} },
+}
+
+// reset releases the references created while building and empties the
+// buffers for reuse.
+func (b *cfDictBuilder) reset() {
+	for _, ref := range b.release {
+		Release(ref)
+	}
+	b.names = b.names[:0]
+	b.keys = b.keys[:0]
+	b.values = b.values[:0]
+	b.release = b.release[:0]
 }
 
 // ConvertMapToCFDictionary converts a map to a CFDictionary and if non-nil,
 // must be released with Release(ref).
 func ConvertMapToCFDictionary(attr map[string]interface{}) (C.CFDictionaryRef, error) {
-	m := make(map[C.CFTypeRef]C.CFTypeRef)
-	for key, i := range attr {
-		var valueRef C.CFTypeRef
-		switch val := i.(type) {
-		default:
-			return 0, fmt.Errorf("Unsupported value type: %v", reflect.TypeOf(i))
-		case C.CFTypeRef:
-			valueRef = val
-		case bool:
-			if val {
-				valueRef = C.CFTypeRef(C.kCFBooleanTrue)
-			} else {
-				valueRef = C.CFTypeRef(C.kCFBooleanFalse)
-			}
-		case int32:
-			valueRef = C.CFTypeRef(Int32ToCFNumber(val))
-			defer Release(valueRef)
-		case []byte:
-			bytesRef, err := BytesToCFData(val)
-			if err != nil {
-				return 0, err
-			}
-			valueRef = C.CFTypeRef(bytesRef)
-			defer Release(valueRef)
-		case string:
-			stringRef, err := StringToCFString(val)
-			if err != nil {
-				return 0, err
-			}
-			valueRef = C.CFTypeRef(stringRef)
-			defer Release(valueRef)
-		case Convertable:
-			convertedRef, err := val.Convert()
+	b := cfDictBuilderPool.Get().(*cfDictBuilder)
+	defer func() {
+		b.reset()
+		cfDictBuilderPool.Put(b)
+	}()
+
+	// Add the attributes in key order, so the same attributes always build
+	// the same dictionary.
+	for key := range attr {
+		b.names = append(b.names, key)
+	}
+	sort.Strings(b.names)
+	for _, key := range b.names {
+		valueRef, owned, err := convertValue(attr[key])
+		if err != nil {
+			return 0, err
+		}
+		if owned {
+			b.release = append(b.release, valueRef)
+		}
+		keyRef, ok := attrKeyRefs[key]
+		if !ok {
+			cfKey, err := StringToCFString(key)
 			if err != nil {
 				return 0, err
 			}
-			valueRef = convertedRef
-			defer Release(valueRef)
+			keyRef = C.CFTypeRef(cfKey)
+			b.release = append(b.release, keyRef)
+		}
+		b.keys = append(b.keys, C.uintptr_t(keyRef))
+		b.values = append(b.values, C.uintptr_t(valueRef))
+	}
+
+	var keysPointer, valuesPointer *C.uintptr_t
+	if len(b.keys) > 0 {
+		keysPointer = &b.keys[0]
+		valuesPointer = &b.values[0]
+	}
+	cfDict := C.CFDictionaryCreateSafe2(C.kCFAllocatorDefault, keysPointer, valuesPointer, C.CFIndex(len(b.keys)),
+		&C.kCFTypeDictionaryKeyCallBacks, &C.kCFTypeDictionaryValueCallBacks) //nolint
+	if cfDict == 0 {
+		return 0, fmt.Errorf("CFDictionaryCreate failed")
+	}
+	trackCF(C.CFTypeRef(cfDict))
+	return cfDict, nil
+}
+
+// convertValue converts an attribute value to a CFTypeRef. If owned is true,
+// the reference must be released with Release(ref).
+func convertValue(i interface{}) (ref C.CFTypeRef, owned bool, err error) {
+	switch val := i.(type) {
+	case C.CFTypeRef:
+		return val, false, nil
+	case bool:
+		if val {
+			return C.CFTypeRef(C.kCFBooleanTrue), false, nil
 		}
-		keyRef, err := StringToCFString(key)
+		return C.CFTypeRef(C.kCFBooleanFalse), false, nil
+	case int32:
+		return C.CFTypeRef(Int32ToCFNumber(val)), true, nil
+	case int, int8, int16, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		numberRef, err := NumberToCFNumber(val)
 		if err != nil {
-			return 0, err
+			return 0, false, err
+		}
+		return C.CFTypeRef(numberRef), true, nil
+	case []byte:
+		bytesRef, err := BytesToCFData(val)
+		if err != nil {
+			return 0, false, err
+		}
+		return C.CFTypeRef(bytesRef), true, nil
+	case time.Time:
+		return C.CFTypeRef(TimeToCFDate(val)), true, nil
+	case string:
+		stringRef, err := StringToCFString(val)
+		if err != nil {
+			return 0, false, err
 		}
-		m[C.CFTypeRef(keyRef)] = valueRef
-		defer Release(C.CFTypeRef(keyRef))
+		return C.CFTypeRef(stringRef), true, nil
+	case Convertable:
+		convertedRef, err := val.Convert()
+		if err != nil {
+			return 0, false, err
+		}
+		return convertedRef, true, nil
 	}
+	return 0, false, fmt.Errorf("Unsupported value type: %v", reflect.TypeOf(i))
+}
 
-	cfDict, err := MapToCFDictionary(m)
-	if err != nil {
-		return 0, err
+// CFError is a CFErrorRef converted to Go.
+type CFError struct {
+	Domain      string
+	Code        int
+	Description string
+	// UserInfo has the values of the user info dictionary that could be
+	// converted, keyed by string keys
+	UserInfo map[string]interface{}
+}
+
+func (e *CFError) Error() string {
+	if e.Description != "" {
+		return e.Description
 	}
-	return cfDict, nil
+	return fmt.Sprintf("CFError %s (%d)", e.Domain, e.Code)
+}
+
+// OSStatus returns the OSStatus of the error if its domain is
+// NSOSStatusErrorDomain.
+func (e *CFError) OSStatus() (int, bool) {
+	if e.Domain != CFStringToString(C.kCFErrorDomainOSStatus) {
+		return 0, false
+	}
+	return e.Code, true
+}
+
+// Unwrap returns the Error for the OSStatus of the error, if any, so
+// errors.Is can match it against Error values.
+func (e *CFError) Unwrap() error {
+	if status, ok := e.OSStatus(); ok {
+		return Error(status)
+	}
+	return nil
+}
+
+// CFErrorError returns a *CFError for a CFErrorRef.
+func CFErrorError(cerr C.CFErrorRef) error {
+	e := &CFError{
+		Domain: CFStringToString(C.CFErrorGetDomain(cerr)),
+		Code:   int(C.CFErrorGetCode(cerr)),
+	}
+	if cfStr := C.CFErrorCopyDescription(cerr); cfStr != 0 {
+		e.Description = CFStringToString(cfStr)
+		Release(C.CFTypeRef(cfStr))
+	}
+	if userInfo := C.CFErrorCopyUserInfo(cerr); userInfo != 0 {
+		e.UserInfo = make(map[string]interface{})
+		for k, v := range CFDictionaryToMap(userInfo) {
+			if C.CFGetTypeID(k) != C.CFStringGetTypeID() {
+				continue
+			}
+			if val, err := Convert(v); err == nil {
+				e.UserInfo[CFStringToString(C.CFStringRef(k))] = val
+			}
+		}
+		Release(C.CFTypeRef(userInfo))
+	}
+	return e
 }
 
 // CFTypeDescription returns type string for CFTypeRef.
@@ -272,6 +509,8 @@ func Convert(ref C.CFTypeRef) (interface{}, error) {
 			return true, nil
 		}
 		return false, nil
+	} else if typeID == C.CFDateGetTypeID() {
+		return CFDateToTime(C.CFDateRef(ref)), nil
 	}
 
 	return nil, fmt.Errorf("Invalid type: %s", CFTypeDescription(ref))
@@ -296,6 +535,58 @@ func ConvertCFDictionary(d C.CFDictionaryRef) (map[interface{}]interface{}, erro
 	return result, nil
 }
 
+// ConvertCFValue converts a CFTypeRef to plain Go values, recursing into
+// arrays and dictionaries: strings, []byte, numbers (as by
+// CFNumberToInterface), bool, time.Time, []interface{} and
+// map[string]interface{}. Dictionaries with non-string keys are converted to
+// map[interface{}]interface{}. Unlike Convert, values of other CF types (e.g.
+// SecAccessControl) don't fail the conversion, but are converted to their
+// type description.
+func ConvertCFValue(ref C.CFTypeRef) interface{} {
+	switch C.CFGetTypeID(ref) {
+	case C.CFDictionaryGetTypeID():
+		m := CFDictionaryToMap(C.CFDictionaryRef(ref))
+		stringKeys := true
+		for k := range m {
+			if C.CFGetTypeID(k) != C.CFStringGetTypeID() {
+				stringKeys = false
+				break
+			}
+		}
+		if stringKeys {
+			result := make(map[string]interface{}, len(m))
+			for k, v := range m {
+				result[CFStringToString(C.CFStringRef(k))] = ConvertCFValue(v)
+			}
+			return result
+		}
+		result := make(map[interface{}]interface{}, len(m))
+		for k, v := range m {
+			key := ConvertCFValue(k)
+			switch kv := key.(type) {
+			case []byte:
+				key = string(kv)
+			case []interface{}, map[string]interface{}, map[interface{}]interface{}:
+				// Unhashable keys are described instead.
+				key = CFTypeDescription(k)
+			}
+			result[key] = ConvertCFValue(v)
+		}
+		return result
+	case C.CFArrayGetTypeID():
+		arr := CFArrayToArray(C.CFArrayRef(ref))
+		result := make([]interface{}, 0, len(arr))
+		for _, v := range arr {
+			result = append(result, ConvertCFValue(v))
+		}
+		return result
+	}
+	if v, err := Convert(ref); err == nil {
+		return v
+	}
+	return CFTypeDescription(ref)
+}
+
 // CFNumberToInterface converts the CFNumberRef to the most appropriate numeric
 // type.
 // This code is from github.com/kballard/go-osx-plist.
@@ -368,3 +659,13 @@ func CFNumberToInterface(cfNumber C.CFNumberRef) interface{} {
 	}
 	panic("Unknown CFNumber type")
 }
+
+// Wrappers around C functions for testing.
+
+func releaseCFNumber(n C.CFNumberRef) {
+	Release(C.CFTypeRef(n))
+}
+
+func releaseCFDictionary(d C.CFDictionaryRef) {
+	Release(C.CFTypeRef(d))
+}
@@ -0,0 +1,68 @@
+//go:build darwin && !ios
+// +build darwin,!ios
+
+package keychain
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNumberToCFNumber(t *testing.T) {
+	for _, v := range []interface{}{int(-42), int8(-8), int16(16), int32(32), int64(math.MinInt64), uint(7), uint8(255), uint16(65535), uint32(math.MaxUint32), uint64(math.MaxInt64)} {
+		n, err := NumberToCFNumber(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i, ok := CFNumberToInt64(n)
+		releaseCFNumber(n)
+		if !ok {
+			t.Fatalf("expected integer for %T", v)
+		}
+		if want := toInt64(v); i != want {
+			t.Fatalf("expected %d, got %d", want, i)
+		}
+	}
+
+	n, err := NumberToCFNumber(1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseCFNumber(n)
+	if _, ok := CFNumberToInt64(n); ok {
+		t.Fatal("expected float not to convert to int64")
+	}
+	if f := CFNumberToFloat64(n); f != 1.5 {
+		t.Fatalf("expected 1.5, got %f", f)
+	}
+
+	if _, err := NumberToCFNumber(uint64(math.MaxUint64)); err == nil {
+		t.Fatal("expected error for uint64 overflow")
+	}
+}
+
+func toInt64(v interface{}) int64 {
+	switch val := v.(type) {
+	case int:
+		return int64(val)
+	case int8:
+		return int64(val)
+	case int16:
+		return int64(val)
+	case int32:
+		return int64(val)
+	case int64:
+		return val
+	case uint:
+		return int64(val)
+	case uint8:
+		return int64(val)
+	case uint16:
+		return int64(val)
+	case uint32:
+		return int64(val)
+	case uint64:
+		return int64(val)
+	}
+	panic("unexpected type")
+}
@@ -44,7 +44,9 @@ func TimeToCFDate(t time.Time) C.CFDateRef {
 	s := t.Unix()
 	ns := int64(t.Nanosecond())
 	abs := unixToAbsoluteTime(s, ns)
-	return C.CFDateCreate(C.kCFAllocatorDefault, abs)
+	cfDate := C.CFDateCreate(C.kCFAllocatorDefault, abs)
+	trackCF(C.CFTypeRef(cfDate))
+	return cfDate
 }
 
 // CFDateToTime will convert the given CFDateRef to a time.Time.
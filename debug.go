@@ -0,0 +1,67 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation
+
+#include <CoreFoundation/CoreFoundation.h>
+*/
+import "C"
+import (
+	"fmt"
+	"time"
+)
+
+// DebugQuery, if set, is called with the name of the Security function and
+// the attributes of each query passed to SecItemAdd, SecItemCopyMatching,
+// SecItemUpdate and SecItemDelete, so you can see exactly what query was
+// built. Item data and other byte values are redacted to their length. Set it
+// before calling keychain functions from multiple goroutines.
+//
+// For example:
+//
+//	keychain.DebugQuery = func(op string, query map[string]string) {
+//		log.Printf("%s: %v", op, query)
+//	}
+var DebugQuery func(op string, query map[string]string)
+
+func debugQuery(op string, attr map[string]interface{}) {
+	if DebugQuery == nil {
+		return
+	}
+	query := make(map[string]string, len(attr))
+	for key, v := range attr {
+		query[key] = debugValue(key, v)
+	}
+	DebugQuery(op, query)
+}
+
+func debugValue(key string, v interface{}) string {
+	switch val := v.(type) {
+	case []byte:
+		if key == DataKey {
+			return fmt.Sprintf("<redacted %d bytes>", len(val))
+		}
+		return fmt.Sprintf("<%d bytes>", len(val))
+	case string:
+		return fmt.Sprintf("%q", val)
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprintf("%v", val)
+	case time.Time:
+		return val.String()
+	case C.CFTypeRef:
+		if val == 0 {
+			return "NULL"
+		}
+		switch C.CFGetTypeID(val) {
+		case C.CFStringGetTypeID():
+			return CFStringToString(C.CFStringRef(val))
+		case C.CFBooleanGetTypeID():
+			return fmt.Sprintf("%v", C.CFBooleanGetValue(C.CFBooleanRef(val)) != 0)
+		}
+		return CFTypeDescription(val)
+	}
+	return fmt.Sprintf("<%T>", v)
+}
@@ -0,0 +1,18 @@
+// Package keychain is a Go wrapper for the macOS and iOS Keychain
+// (Security.framework).
+//
+// # Concurrency
+//
+// The package functions are safe to call from multiple goroutines. Package
+// level values such as the attribute keys are initialized once when the
+// package is loaded and never modified.
+//
+// An Item is not safe to modify concurrently, but once built it can be
+// passed to any number of concurrent AddItem, QueryItem, UpdateItem or
+// DeleteItem calls, which don't modify it. CertificateRef, Policy and
+// TrustRef values are safe for concurrent use, except that Close must not be
+// called while they are in use.
+//
+// DebugQuery must be set before keychain functions are called concurrently.
+// SetLogger can be called at any time.
+package keychain
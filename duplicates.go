@@ -0,0 +1,145 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sort"
+)
+
+// DuplicateGroup is a set of generic password items with the same account,
+// data and other attributes, differing only in label, dates or the keychain
+// they're in.
+type DuplicateGroup struct {
+	// Keep is the most recently modified item
+	Keep QueryResult
+	// Duplicates are the other items
+	Duplicates []QueryResult
+}
+
+// duplicateKey identifies items that are duplicates of each other. The
+// access group isn't part of it, since items in the file-based keychain
+// don't have one.
+type duplicateKey struct {
+	account        string
+	description    string
+	comment        string
+	generic        string
+	synchronizable Synchronizable
+	dataSum        [sha256.Size]byte
+}
+
+// FindDuplicates returns the groups of duplicate generic password items for
+// service, which are often left by racy writers. The results don't include
+// the items' data.
+//
+// The account, access group and synchronizable attributes identify a generic
+// password for service within a keychain, so duplicates are only found across
+// keychains: on macOS, an item that was written to both the file-based
+// keychain and the data protection keychain (see
+// SetUseDataProtectionKeychain). A group has at most one item per keychain;
+// matching items in different access groups of the same keychain aren't
+// duplicates of each other, and neither is grouped. The data protection
+// keychain is skipped if the binary lacks the entitlement to use it. On iOS,
+// which has a single keychain, there are no duplicates.
+func FindDuplicates(service string) ([]DuplicateGroup, error) {
+	groups, _, err := findDuplicates(service)
+	return groups, err
+}
+
+// findDuplicates is FindDuplicates, also returning the keychain selection of
+// each item by persistent ref.
+func findDuplicates(service string) ([]DuplicateGroup, map[string]Item, error) {
+	var results [][]QueryResult
+	keychains := make(map[string]Item)
+	for _, selection := range keychainSelections() {
+		r, err := Query(service, withKeychain(selection), WithReturnData())
+		if errors.Is(err, ErrorMissingEntitlement) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, item := range r {
+			keychains[string(item.PersistentRef)] = selection
+		}
+		results = append(results, r)
+	}
+	return groupDuplicates(results), keychains, nil
+}
+
+// groupDuplicates groups the duplicate results, given per keychain, wiping
+// and removing their data.
+func groupDuplicates(results [][]QueryResult) []DuplicateGroup {
+	type member struct {
+		result   QueryResult
+		keychain int
+	}
+	groups := make(map[duplicateKey][]member)
+	for i, keychainResults := range results {
+		for _, r := range keychainResults {
+			key := duplicateKey{
+				account:        r.Account,
+				description:    r.Description,
+				comment:        r.Comment,
+				generic:        string(r.Generic),
+				synchronizable: r.Synchronizable,
+				dataSum:        sha256.Sum256(r.Data),
+			}
+			r.Wipe()
+			r.Data = nil
+			delete(r.RawAttributes, DataKey)
+			groups[key] = append(groups[key], member{result: r, keychain: i})
+		}
+	}
+
+	var duplicates []DuplicateGroup
+	for _, members := range groups {
+		seen := make(map[int]bool)
+		group := make([]QueryResult, 0, len(members))
+		for _, m := range members {
+			if seen[m.keychain] {
+				group = nil
+				break
+			}
+			seen[m.keychain] = true
+			group = append(group, m.result)
+		}
+		if len(group) < 2 {
+			continue
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].ModificationDate.After(group[j].ModificationDate)
+		})
+		duplicates = append(duplicates, DuplicateGroup{Keep: group[0], Duplicates: group[1:]})
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].Keep.Account < duplicates[j].Keep.Account
+	})
+	return duplicates
+}
+
+// RemoveDuplicates deletes the duplicate generic password items for service
+// found by FindDuplicates, keeping the most recently modified item of each
+// group. Each item is deleted from the keychain it was found in. It returns
+// the removed items, including those removed before an error.
+func RemoveDuplicates(service string) ([]QueryResult, error) {
+	groups, keychains, err := findDuplicates(service)
+	if err != nil {
+		return nil, err
+	}
+	var removed []QueryResult
+	for _, group := range groups {
+		for _, r := range group.Duplicates {
+			ref := keychains[string(r.PersistentRef)].keychainSelection()
+			ref.SetBytes(ValuePersistentRefKey, r.PersistentRef)
+			if err := DeleteItem(ref); err != nil {
+				return removed, err
+			}
+			removed = append(removed, r)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,27 @@
+package keychain
+
+import "fmt"
+
+// FourCharCode is a four character code, as used by the creator and type
+// attributes, e.g. 'aapl'.
+type FourCharCode uint32
+
+// ParseFourCharCode converts a four character ASCII string to a FourCharCode.
+func ParseFourCharCode(s string) (FourCharCode, error) {
+	if len(s) != 4 {
+		return 0, fmt.Errorf("four char code must be 4 characters: %q", s)
+	}
+	var c FourCharCode
+	for i := 0; i < 4; i++ {
+		if s[i] > 0x7f {
+			return 0, fmt.Errorf("four char code must be ASCII: %q", s)
+		}
+		c = c<<8 | FourCharCode(s[i])
+	}
+	return c, nil
+}
+
+// String returns the four character string for the code.
+func (c FourCharCode) String() string {
+	return string([]byte{byte(c >> 24), byte(c >> 16), byte(c >> 8), byte(c)})
+}
@@ -0,0 +1,19 @@
+package keychain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFourCharCode(t *testing.T) {
+	c, err := ParseFourCharCode("aapl")
+	require.NoError(t, err)
+	require.Equal(t, FourCharCode(0x6161706c), c)
+	require.Equal(t, "aapl", c.String())
+
+	_, err = ParseFourCharCode("toolong")
+	require.Error(t, err)
+	_, err = ParseFourCharCode("テ")
+	require.Error(t, err)
+}
@@ -0,0 +1,43 @@
+// Package logging implements the loggers of the keychain and secretservice
+// packages.
+package logging
+
+import "sync/atomic"
+
+// Logger is used to log unexpected but non-fatal conditions.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Warnf(string, ...interface{})  {}
+
+// Value holds a package's logger. The zero value discards log messages. Set
+// is safe to call while other goroutines are logging.
+type Value struct {
+	// v holds a loggerBox, since atomic.Value requires a consistent type
+	v atomic.Value
+}
+
+type loggerBox struct {
+	Logger
+}
+
+// Set sets the logger. Logging is disabled if l is nil.
+func (v *Value) Set(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	v.v.Store(loggerBox{l})
+}
+
+// Get returns the logger.
+func (v *Value) Get() Logger {
+	if box, ok := v.v.Load().(loggerBox); ok {
+		return box.Logger
+	}
+	return nopLogger{}
+}
@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func TestValue(t *testing.T) {
+	var v Value
+	v.Get().Warnf("discarded")
+
+	l := &recordingLogger{}
+	v.Set(l)
+	v.Get().Debugf("a %d", 1)
+	require.Equal(t, []string{"a 1"}, l.messages)
+
+	v.Set(nil)
+	v.Get().Warnf("discarded")
+	require.Equal(t, []string{"a 1"}, l.messages)
+}
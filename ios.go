@@ -21,3 +21,22 @@ var accessibleTypeRef = map[Accessible]C.CFTypeRef{
 	AccessibleAfterFirstUnlockThisDeviceOnly: C.CFTypeRef(C.kSecAttrAccessibleAfterFirstUnlockThisDeviceOnly),
 	AccessibleAccessibleAlwaysThisDeviceOnly: C.CFTypeRef(C.kSecAttrAccessibleAlwaysThisDeviceOnly),
 }
+
+// SetUseDataProtectionKeychain does nothing on iOS, which only has the data
+// protection keychain.
+func (k *Item) SetUseDataProtectionKeychain(_ bool) {}
+
+// keychainSelectionKeys returns the query keys that select which keychain
+// an item is in.
+func keychainSelectionKeys() []string {
+	return nil
+}
+
+// keychainSelections returns a query item selecting each keychain.
+func keychainSelections() []Item {
+	return []Item{NewItem()}
+}
+
+func diagnosticProbes() []diagnosticProbe {
+	return []diagnosticProbe{{check: "keychain", item: newDiagnosticItem()}}
+}
@@ -0,0 +1,121 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security
+
+#include <CoreFoundation/CoreFoundation.h>
+*/
+import "C"
+import "fmt"
+
+// ItemIterator iterates over the results of a query, resolving each item's
+// attributes (and data) only when it's reached. Use it like bufio.Scanner:
+//
+//	it, err := QueryItems(query, false)
+//	...
+//	for it.Next() {
+//		r := it.Result()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ItemIterator struct {
+	// query selects the keychain the items are resolved in
+	query      Item
+	refs       [][]byte
+	returnData bool
+	result     *QueryResult
+	err        error
+}
+
+// QueryItems returns an iterator over the items matching query. Only the
+// persistent references of the items are fetched up front, so iterating a
+// large keychain doesn't hold every item's attributes in memory. If
+// returnData is true, each result includes the item's data.
+//
+// The match limit and return options of query are ignored. Items deleted
+// during iteration are skipped.
+func QueryItems(query Item, returnData bool) (*ItemIterator, error) {
+	q := query.clone()
+	q.SetMatchLimit(MatchLimitAll)
+	q.SetReturnPersistentRef(true)
+	delete(q.attr, ReturnAttributesKey)
+	delete(q.attr, ReturnDataKey)
+	delete(q.attr, ReturnRefKey)
+	ref, err := QueryItemRef(q)
+	if err != nil {
+		return nil, err
+	}
+	it := &ItemIterator{query: query.keychainSelection(), returnData: returnData}
+	if ref == 0 {
+		return it, nil
+	}
+	defer Release(ref)
+
+	var refs []C.CFTypeRef
+	switch C.CFGetTypeID(ref) {
+	case C.CFArrayGetTypeID():
+		refs = CFArrayToArray(C.CFArrayRef(ref))
+	case C.CFDataGetTypeID():
+		refs = []C.CFTypeRef{ref}
+	default:
+		return nil, fmt.Errorf("Invalid result type: %s", CFTypeDescription(ref))
+	}
+	it.refs = make([][]byte, 0, len(refs))
+	for _, r := range refs {
+		if C.CFGetTypeID(r) != C.CFDataGetTypeID() {
+			return nil, fmt.Errorf("Invalid result type: %s", CFTypeDescription(r))
+		}
+		b, err := CFDataToBytes(C.CFDataRef(r))
+		if err != nil {
+			return nil, err
+		}
+		it.refs = append(it.refs, b)
+	}
+	return it, nil
+}
+
+// Len returns the number of items not yet iterated over.
+func (it *ItemIterator) Len() int {
+	return len(it.refs)
+}
+
+// Next resolves the next item, returning false when there are no more items
+// or an error occurred.
+func (it *ItemIterator) Next() bool {
+	it.result = nil
+	for it.err == nil && len(it.refs) > 0 {
+		ref := it.refs[0]
+		it.refs = it.refs[1:]
+		result, err := getItemByPersistentRef(it.query, ref, it.returnData)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if result == nil {
+			continue
+		}
+		result.PersistentRef = ref
+		it.result = result
+		return true
+	}
+	return false
+}
+
+// Result returns the item resolved by the last call to Next, or an empty
+// result if Next hasn't been called or returned false.
+func (it *ItemIterator) Result() QueryResult {
+	if it.result == nil {
+		return QueryResult{}
+	}
+	return *it.result
+}
+
+// Err returns the error that stopped iteration, if any.
+func (it *ItemIterator) Err() error {
+	return it.err
+}
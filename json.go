@@ -0,0 +1,171 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// jsonResult is the JSON encoding of a QueryResult. Byte values are base64
+// encoded.
+type jsonResult struct {
+	Service            string                 `json:",omitempty"`
+	Server             string                 `json:",omitempty"`
+	Protocol           Protocol               `json:",omitempty"`
+	AuthenticationType AuthenticationType     `json:",omitempty"`
+	Port               int32                  `json:",omitempty"`
+	Path               string                 `json:",omitempty"`
+	Account            string                 `json:",omitempty"`
+	AccessGroup        string                 `json:",omitempty"`
+	Label              string                 `json:",omitempty"`
+	Description        string                 `json:",omitempty"`
+	Comment            string                 `json:",omitempty"`
+	Data               []byte                 `json:",omitempty"`
+	DataRedacted       bool                   `json:",omitempty"`
+	CreationDate       *time.Time             `json:",omitempty"`
+	ModificationDate   *time.Time             `json:",omitempty"`
+	Creator            string                 `json:",omitempty"`
+	Type               string                 `json:",omitempty"`
+	Generic            []byte                 `json:",omitempty"`
+	Subject            []byte                 `json:",omitempty"`
+	Issuer             []byte                 `json:",omitempty"`
+	SerialNumber       []byte                 `json:",omitempty"`
+	SubjectKeyID       []byte                 `json:",omitempty"`
+	PublicKeyHash      []byte                 `json:",omitempty"`
+	ApplicationTag     []byte                 `json:",omitempty"`
+	ApplicationLabel   []byte                 `json:",omitempty"`
+	IsPermanent        bool                   `json:",omitempty"`
+	KeySizeInBits      int                    `json:",omitempty"`
+	TokenID            string                 `json:",omitempty"`
+	Accessible         Accessible             `json:",omitempty"`
+	Synchronizable     Synchronizable         `json:",omitempty"`
+	AccessControl      *AccessControl         `json:",omitempty"`
+	PersistentRef      []byte                 `json:",omitempty"`
+	Certificate        []byte                 `json:",omitempty"`
+	RawAttributes      map[string]interface{} `json:",omitempty"`
+}
+
+// MarshalJSON encodes the result with its data redacted, so results can be
+// logged or serialized safely. DataRedacted is true if the result had data.
+// Use MarshalJSONWithData to include the data.
+func (r QueryResult) MarshalJSON() ([]byte, error) {
+	return r.marshalJSON(false)
+}
+
+// MarshalJSONWithData encodes the result including its data.
+func (r QueryResult) MarshalJSONWithData() ([]byte, error) {
+	return r.marshalJSON(true)
+}
+
+func (r QueryResult) marshalJSON(includeData bool) ([]byte, error) {
+	j := jsonResult{
+		Service:            r.Service,
+		Server:             r.Server,
+		Protocol:           r.Protocol,
+		AuthenticationType: r.AuthenticationType,
+		Port:               r.Port,
+		Path:               r.Path,
+		Account:            r.Account,
+		AccessGroup:        r.AccessGroup,
+		Label:              r.Label,
+		Description:        r.Description,
+		Comment:            r.Comment,
+		Generic:            r.Generic,
+		Subject:            r.Subject,
+		Issuer:             r.Issuer,
+		SerialNumber:       r.SerialNumber,
+		SubjectKeyID:       r.SubjectKeyID,
+		PublicKeyHash:      r.PublicKeyHash,
+		ApplicationTag:     r.ApplicationTag,
+		ApplicationLabel:   r.ApplicationLabel,
+		IsPermanent:        r.IsPermanent,
+		KeySizeInBits:      r.KeySizeInBits,
+		TokenID:            r.TokenID,
+		Accessible:         r.Accessible,
+		Synchronizable:     r.Synchronizable,
+		AccessControl:      r.AccessControl,
+		PersistentRef:      r.PersistentRef,
+	}
+	if includeData {
+		j.Data = r.Data
+	} else {
+		j.DataRedacted = r.Data != nil
+	}
+	if !r.CreationDate.IsZero() {
+		j.CreationDate = &r.CreationDate
+	}
+	if !r.ModificationDate.IsZero() {
+		j.ModificationDate = &r.ModificationDate
+	}
+	if r.Creator != 0 {
+		j.Creator = r.Creator.String()
+	}
+	if r.Type != 0 {
+		j.Type = r.Type.String()
+	}
+	if r.Certificate != nil {
+		der, err := r.Certificate.Data()
+		if err != nil {
+			return nil, err
+		}
+		j.Certificate = der
+	}
+	if len(r.RawAttributes) > 0 {
+		j.RawAttributes = make(map[string]interface{}, len(r.RawAttributes))
+		for k, v := range r.RawAttributes {
+			if k == DataKey && !includeData {
+				continue
+			}
+			j.RawAttributes[k] = jsonValue(v)
+		}
+	}
+	return json.Marshal(j)
+}
+
+// jsonValue converts values from Convert that encoding/json can't encode,
+// i.e. maps with non-string keys.
+func jsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			m[fmt.Sprint(k)] = jsonValue(v)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(val))
+		for i, v := range val {
+			a[i] = jsonValue(v)
+		}
+		return a
+	}
+	return v
+}
+
+// MarshalJSON encodes the item's attributes with its data redacted, as
+// described for DebugQuery. Use MarshalJSONWithData to include the data.
+func (k Item) MarshalJSON() ([]byte, error) {
+	return k.marshalJSON(false)
+}
+
+// MarshalJSONWithData encodes the item's attributes including its data
+// (base64 encoded).
+func (k Item) MarshalJSONWithData() ([]byte, error) {
+	return k.marshalJSON(true)
+}
+
+func (k Item) marshalJSON(includeData bool) ([]byte, error) {
+	attrs := make(map[string]string, len(k.attr))
+	for key, v := range k.attr {
+		if b, ok := v.([]byte); ok && key == DataKey && includeData {
+			attrs[key] = base64.StdEncoding.EncodeToString(b)
+			continue
+		}
+		attrs[key] = debugValue(key, v)
+	}
+	return json.Marshal(attrs)
+}
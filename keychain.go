@@ -15,7 +15,10 @@ package keychain
 */
 import "C"
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -67,8 +70,56 @@ var (
 	ErrorInvalidOwnerEdit = Error(C.errSecInvalidOwnerEdit)
 	// ErrorUserCanceled corresponds to errSecUserCanceled result code
 	ErrorUserCanceled = Error(C.errSecUserCanceled)
+	// ErrorNoSuchAttr corresponds to errSecNoSuchAttr result code
+	ErrorNoSuchAttr = Error(C.errSecNoSuchAttr)
+	// ErrorNoSuchClass corresponds to errSecNoSuchClass result code
+	ErrorNoSuchClass = Error(C.errSecNoSuchClass)
+	// ErrorNoDefaultKeychain corresponds to errSecNoDefaultKeychain result code
+	ErrorNoDefaultKeychain = Error(C.errSecNoDefaultKeychain)
+	// ErrorInteractionRequired corresponds to errSecInteractionRequired result code
+	ErrorInteractionRequired = Error(C.errSecInteractionRequired)
+	// ErrorMissingEntitlement corresponds to errSecMissingEntitlement result code
+	ErrorMissingEntitlement = Error(C.errSecMissingEntitlement)
+	// ErrorInvalidData corresponds to errSecInvalidData result code
+	ErrorInvalidData = Error(C.errSecInvalidData)
+	// ErrorVerifyFailed corresponds to errSecVerifyFailed result code
+	ErrorVerifyFailed = Error(C.errSecVerifyFailed)
+	// ErrorNotTrusted corresponds to errSecNotTrusted result code
+	ErrorNotTrusted = Error(C.errSecNotTrusted)
+	// ErrorItemIllegalQuery corresponds to errSecItemIllegalQuery result code
+	ErrorItemIllegalQuery = Error(C.errSecItemIllegalQuery)
 )
 
+// IsNotFound returns true if err is ErrorItemNotFound
+func IsNotFound(err error) bool {
+	return isError(err, ErrorItemNotFound)
+}
+
+// IsAuthRequired returns true if err means the user must authenticate, or
+// failed to authenticate, to access an item
+func IsAuthRequired(err error) bool {
+	return isError(err, ErrorInteractionNotAllowed, ErrorInteractionRequired, ErrorAuthFailed)
+}
+
+// IsPermissionDenied returns true if err means the process isn't allowed to
+// access an item, e.g. because of a missing entitlement
+func IsPermissionDenied(err error) bool {
+	return isError(err, ErrorMissingEntitlement, ErrorNoAccessForItem, ErrorReadOnly, ErrorInvalidOwnerEdit)
+}
+
+func isError(err error, targets ...Error) bool {
+	var kerr Error
+	if !errors.As(err, &kerr) {
+		return false
+	}
+	for _, target := range targets {
+		if kerr == target {
+			return true
+		}
+	}
+	return false
+}
+
 func checkError(errCode C.OSStatus) error {
 	if errCode == C.errSecSuccess {
 		return nil
@@ -76,6 +127,33 @@ func checkError(errCode C.OSStatus) error {
 	return Error(errCode)
 }
 
+// OpError is an error from a Security framework operation. Errors from
+// AddItem, UpdateItem, DeleteItem and QueryItem are returned as a plain Error,
+// so they can be compared with ==; errors from other functions may be wrapped
+// in an OpError, so use errors.Is or errors.As to check for an Error.
+type OpError struct {
+	// Op is the failing operation, e.g. "SecKeychainCreate"
+	Op  string
+	Err error
+}
+
+func (e *OpError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// checkOpError is like checkError, but wraps the error with the operation.
+func checkOpError(op string, errCode C.OSStatus) error {
+	if err := checkError(errCode); err != nil {
+		return &OpError{Op: op, Err: err}
+	}
+	return nil
+}
+
 func (k Error) Error() (msg string) {
 	// SecCopyErrorMessageString is only available on OSX, so derive manually.
 	// Messages derived from `$ security error $errcode`.
@@ -124,6 +202,24 @@ func (k Error) Error() (msg string) {
 		msg = "An invalid attempt to change the owner of an item."
 	case ErrorUserCanceled:
 		msg = "User canceled the operation."
+	case ErrorNoSuchAttr:
+		msg = "The attribute does not exist."
+	case ErrorNoSuchClass:
+		msg = "The item class does not exist."
+	case ErrorNoDefaultKeychain:
+		msg = "A default keychain could not be found."
+	case ErrorInteractionRequired:
+		msg = "User interaction is required, but is currently not allowed."
+	case ErrorMissingEntitlement:
+		msg = "A required entitlement isn't present."
+	case ErrorInvalidData:
+		msg = "The data is not valid."
+	case ErrorVerifyFailed:
+		msg = "A cryptographic verification failure has occurred."
+	case ErrorNotTrusted:
+		msg = "The trust policy was not trusted."
+	case ErrorItemIllegalQuery:
+		msg = "The query is not valid."
 	default:
 		msg = "Keychain Error."
 	}
@@ -145,6 +241,9 @@ var (
 	*/
 	SecClassGenericPassword  SecClass = 1
 	SecClassInternetPassword SecClass = 2
+	SecClassCertificate      SecClass = 3
+	SecClassCryptoKey        SecClass = 4
+	SecClassIdentity         SecClass = 5
 )
 
 // SecClassKey is the key type for SecClass
@@ -152,6 +251,9 @@ var SecClassKey = attrKey(C.CFTypeRef(C.kSecClass))
 var secClassTypeRef = map[SecClass]C.CFTypeRef{
 	SecClassGenericPassword:  C.CFTypeRef(C.kSecClassGenericPassword),
 	SecClassInternetPassword: C.CFTypeRef(C.kSecClassInternetPassword),
+	SecClassCertificate:      C.CFTypeRef(C.kSecClassCertificate),
+	SecClassCryptoKey:        C.CFTypeRef(C.kSecClassKey),
+	SecClassIdentity:         C.CFTypeRef(C.kSecClassIdentity),
 }
 
 var (
@@ -168,6 +270,8 @@ var (
 	PortKey = attrKey(C.CFTypeRef(C.kSecAttrPort))
 	// PathKey is for kSecAttrPath
 	PathKey = attrKey(C.CFTypeRef(C.kSecAttrPath))
+	// SecurityDomainKey is for kSecAttrSecurityDomain
+	SecurityDomainKey = attrKey(C.CFTypeRef(C.kSecAttrSecurityDomain))
 
 	// LabelKey is for kSecAttrLabel
 	LabelKey = attrKey(C.CFTypeRef(C.kSecAttrLabel))
@@ -175,6 +279,10 @@ var (
 	AccountKey = attrKey(C.CFTypeRef(C.kSecAttrAccount))
 	// AccessGroupKey is for kSecAttrAccessGroup
 	AccessGroupKey = attrKey(C.CFTypeRef(C.kSecAttrAccessGroup))
+	// AccessGroupToken is the access group of items provided by CryptoTokenKit
+	// token extensions such as smart cards, for kSecAttrAccessGroupToken. Use
+	// it with SetAccessGroup to query token items.
+	AccessGroupToken = attrKey(C.CFTypeRef(C.kSecAttrAccessGroupToken))
 	// DataKey is for kSecValueData
 	DataKey = attrKey(C.CFTypeRef(C.kSecValueData))
 	// DescriptionKey is for kSecAttrDescription
@@ -185,6 +293,138 @@ var (
 	CreationDateKey = attrKey(C.CFTypeRef(C.kSecAttrCreationDate))
 	// ModificationDateKey is for kSecAttrModificationDate
 	ModificationDateKey = attrKey(C.CFTypeRef(C.kSecAttrModificationDate))
+	// GenericKey is for kSecAttrGeneric
+	GenericKey = attrKey(C.CFTypeRef(C.kSecAttrGeneric))
+	// CreatorKey is for kSecAttrCreator
+	CreatorKey = attrKey(C.CFTypeRef(C.kSecAttrCreator))
+	// TypeKey is for kSecAttrType
+	TypeKey = attrKey(C.CFTypeRef(C.kSecAttrType))
+
+	// CertificateTypeKey is for kSecAttrCertificateType
+	CertificateTypeKey = attrKey(C.CFTypeRef(C.kSecAttrCertificateType))
+	// SubjectKey is for kSecAttrSubject
+	SubjectKey = attrKey(C.CFTypeRef(C.kSecAttrSubject))
+	// IssuerKey is for kSecAttrIssuer
+	IssuerKey = attrKey(C.CFTypeRef(C.kSecAttrIssuer))
+	// SerialNumberKey is for kSecAttrSerialNumber
+	SerialNumberKey = attrKey(C.CFTypeRef(C.kSecAttrSerialNumber))
+	// SubjectKeyIDKey is for kSecAttrSubjectKeyID
+	SubjectKeyIDKey = attrKey(C.CFTypeRef(C.kSecAttrSubjectKeyID))
+
+	// PublicKeyHashKey is for kSecAttrPublicKeyHash
+	PublicKeyHashKey = attrKey(C.CFTypeRef(C.kSecAttrPublicKeyHash))
+
+	// ApplicationTagKey is for kSecAttrApplicationTag
+	ApplicationTagKey = attrKey(C.CFTypeRef(C.kSecAttrApplicationTag))
+	// ApplicationLabelKey is for kSecAttrApplicationLabel
+	ApplicationLabelKey = attrKey(C.CFTypeRef(C.kSecAttrApplicationLabel))
+	// KeyClassKey is for kSecAttrKeyClass
+	KeyClassKey = attrKey(C.CFTypeRef(C.kSecAttrKeyClass))
+	// KeyTypeKey is for kSecAttrKeyType
+	KeyTypeKey = attrKey(C.CFTypeRef(C.kSecAttrKeyType))
+	// KeySizeInBitsKey is for kSecAttrKeySizeInBits
+	KeySizeInBitsKey = attrKey(C.CFTypeRef(C.kSecAttrKeySizeInBits))
+	// IsPermanentKey is for kSecAttrIsPermanent
+	IsPermanentKey = attrKey(C.CFTypeRef(C.kSecAttrIsPermanent))
+	// TokenIDKey is for kSecAttrTokenID
+	TokenIDKey = attrKey(C.CFTypeRef(C.kSecAttrTokenID))
+)
+
+// Protocol is the protocol of an internet password item. The values are
+// four character codes, e.g. "htps" for ProtocolHTTPS.
+type Protocol string
+
+// Internet Password Protocols
+var (
+	// ProtocolFTP is for kSecAttrProtocolFTP
+	ProtocolFTP = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolFTP)))
+	// ProtocolFTPAccount is for kSecAttrProtocolFTPAccount
+	ProtocolFTPAccount = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolFTPAccount)))
+	// ProtocolHTTP is for kSecAttrProtocolHTTP
+	ProtocolHTTP = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolHTTP)))
+	// ProtocolIRC is for kSecAttrProtocolIRC
+	ProtocolIRC = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolIRC)))
+	// ProtocolNNTP is for kSecAttrProtocolNNTP
+	ProtocolNNTP = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolNNTP)))
+	// ProtocolPOP3 is for kSecAttrProtocolPOP3
+	ProtocolPOP3 = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolPOP3)))
+	// ProtocolSMTP is for kSecAttrProtocolSMTP
+	ProtocolSMTP = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolSMTP)))
+	// ProtocolSOCKS is for kSecAttrProtocolSOCKS
+	ProtocolSOCKS = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolSOCKS)))
+	// ProtocolIMAP is for kSecAttrProtocolIMAP
+	ProtocolIMAP = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolIMAP)))
+	// ProtocolLDAP is for kSecAttrProtocolLDAP
+	ProtocolLDAP = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolLDAP)))
+	// ProtocolAppleTalk is for kSecAttrProtocolAppleTalk
+	ProtocolAppleTalk = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolAppleTalk)))
+	// ProtocolAFP is for kSecAttrProtocolAFP
+	ProtocolAFP = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolAFP)))
+	// ProtocolTelnet is for kSecAttrProtocolTelnet
+	ProtocolTelnet = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolTelnet)))
+	// ProtocolSSH is for kSecAttrProtocolSSH
+	ProtocolSSH = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolSSH)))
+	// ProtocolFTPS is for kSecAttrProtocolFTPS
+	ProtocolFTPS = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolFTPS)))
+	// ProtocolHTTPS is for kSecAttrProtocolHTTPS
+	ProtocolHTTPS = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolHTTPS)))
+	// ProtocolHTTPProxy is for kSecAttrProtocolHTTPProxy
+	ProtocolHTTPProxy = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolHTTPProxy)))
+	// ProtocolHTTPSProxy is for kSecAttrProtocolHTTPSProxy
+	ProtocolHTTPSProxy = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolHTTPSProxy)))
+	// ProtocolFTPProxy is for kSecAttrProtocolFTPProxy
+	ProtocolFTPProxy = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolFTPProxy)))
+	// ProtocolCIFS is for kSecAttrProtocolCIFS
+	ProtocolCIFS = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolCIFS)))
+	// ProtocolSMB is for kSecAttrProtocolSMB
+	ProtocolSMB = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolSMB)))
+	// ProtocolRTSP is for kSecAttrProtocolRTSP
+	ProtocolRTSP = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolRTSP)))
+	// ProtocolRTSPProxy is for kSecAttrProtocolRTSPProxy
+	ProtocolRTSPProxy = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolRTSPProxy)))
+	// ProtocolDAAP is for kSecAttrProtocolDAAP
+	ProtocolDAAP = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolDAAP)))
+	// ProtocolEPPC is for kSecAttrProtocolEPPC
+	ProtocolEPPC = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolEPPC)))
+	// ProtocolIPP is for kSecAttrProtocolIPP
+	ProtocolIPP = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolIPP)))
+	// ProtocolNNTPS is for kSecAttrProtocolNNTPS
+	ProtocolNNTPS = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolNNTPS)))
+	// ProtocolLDAPS is for kSecAttrProtocolLDAPS
+	ProtocolLDAPS = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolLDAPS)))
+	// ProtocolTelnetS is for kSecAttrProtocolTelnetS
+	ProtocolTelnetS = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolTelnetS)))
+	// ProtocolIMAPS is for kSecAttrProtocolIMAPS
+	ProtocolIMAPS = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolIMAPS)))
+	// ProtocolIRCS is for kSecAttrProtocolIRCS
+	ProtocolIRCS = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolIRCS)))
+	// ProtocolPOP3S is for kSecAttrProtocolPOP3S
+	ProtocolPOP3S = Protocol(attrKey(C.CFTypeRef(C.kSecAttrProtocolPOP3S)))
+)
+
+// AuthenticationType is the authentication scheme of an internet password
+// item. The values are four character codes, e.g. "form" for
+// AuthenticationTypeHTMLForm.
+type AuthenticationType string
+
+// Internet Password Authentication Types
+var (
+	// AuthenticationTypeNTLM is for kSecAttrAuthenticationTypeNTLM
+	AuthenticationTypeNTLM = AuthenticationType(attrKey(C.CFTypeRef(C.kSecAttrAuthenticationTypeNTLM)))
+	// AuthenticationTypeMSN is for kSecAttrAuthenticationTypeMSN
+	AuthenticationTypeMSN = AuthenticationType(attrKey(C.CFTypeRef(C.kSecAttrAuthenticationTypeMSN)))
+	// AuthenticationTypeDPA is for kSecAttrAuthenticationTypeDPA
+	AuthenticationTypeDPA = AuthenticationType(attrKey(C.CFTypeRef(C.kSecAttrAuthenticationTypeDPA)))
+	// AuthenticationTypeRPA is for kSecAttrAuthenticationTypeRPA
+	AuthenticationTypeRPA = AuthenticationType(attrKey(C.CFTypeRef(C.kSecAttrAuthenticationTypeRPA)))
+	// AuthenticationTypeHTTPBasic is for kSecAttrAuthenticationTypeHTTPBasic
+	AuthenticationTypeHTTPBasic = AuthenticationType(attrKey(C.CFTypeRef(C.kSecAttrAuthenticationTypeHTTPBasic)))
+	// AuthenticationTypeHTTPDigest is for kSecAttrAuthenticationTypeHTTPDigest
+	AuthenticationTypeHTTPDigest = AuthenticationType(attrKey(C.CFTypeRef(C.kSecAttrAuthenticationTypeHTTPDigest)))
+	// AuthenticationTypeHTMLForm is for kSecAttrAuthenticationTypeHTMLForm
+	AuthenticationTypeHTMLForm = AuthenticationType(attrKey(C.CFTypeRef(C.kSecAttrAuthenticationTypeHTMLForm)))
+	// AuthenticationTypeDefault is for kSecAttrAuthenticationTypeDefault
+	AuthenticationTypeDefault = AuthenticationType(attrKey(C.CFTypeRef(C.kSecAttrAuthenticationTypeDefault)))
 )
 
 // Synchronizable is the items synchronizable status
@@ -231,6 +471,222 @@ const (
 	AccessibleAccessibleAlwaysThisDeviceOnly = 7
 )
 
+// AccessControlFlags are the SecAccessControlCreateFlags of an item's access control
+type AccessControlFlags uint
+
+const (
+	// AccessControlUserPresence requires Touch ID, Face ID, Watch or the device passcode
+	AccessControlUserPresence AccessControlFlags = C.kSecAccessControlUserPresence
+	// AccessControlBiometryAny requires Touch ID or Face ID with any enrolled finger or face
+	AccessControlBiometryAny AccessControlFlags = C.kSecAccessControlBiometryAny
+	// AccessControlBiometryCurrentSet requires Touch ID or Face ID with the currently enrolled fingers or face
+	AccessControlBiometryCurrentSet AccessControlFlags = C.kSecAccessControlBiometryCurrentSet
+	// AccessControlDevicePasscode requires the device passcode
+	AccessControlDevicePasscode AccessControlFlags = C.kSecAccessControlDevicePasscode
+	// AccessControlOr requires any one of the constraints
+	AccessControlOr AccessControlFlags = C.kSecAccessControlOr
+	// AccessControlAnd requires all of the constraints
+	AccessControlAnd AccessControlFlags = C.kSecAccessControlAnd
+	// AccessControlPrivateKeyUsage enables private key usage (for key items)
+	AccessControlPrivateKeyUsage AccessControlFlags = C.kSecAccessControlPrivateKeyUsage
+	// AccessControlApplicationPassword requires an application provided password
+	AccessControlApplicationPassword AccessControlFlags = C.kSecAccessControlApplicationPassword
+)
+
+var accessControlFlagNames = []struct {
+	flag AccessControlFlags
+	name string
+}{
+	{AccessControlUserPresence, "UserPresence"},
+	{AccessControlBiometryAny, "BiometryAny"},
+	{AccessControlBiometryCurrentSet, "BiometryCurrentSet"},
+	{AccessControlDevicePasscode, "DevicePasscode"},
+	{AccessControlOr, "Or"},
+	{AccessControlAnd, "And"},
+	{AccessControlPrivateKeyUsage, "PrivateKeyUsage"},
+	{AccessControlApplicationPassword, "ApplicationPassword"},
+}
+
+// String returns the flag names separated by "|".
+func (f AccessControlFlags) String() string {
+	var names []string
+	for _, n := range accessControlFlagNames {
+		if f&n.flag != 0 {
+			names = append(names, n.name)
+			f &^= n.flag
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint(f)))
+	}
+	if len(names) == 0 {
+		return "None"
+	}
+	return strings.Join(names, "|")
+}
+
+// AccessControl is an item's access control as returned by a query
+type AccessControl struct {
+	Accessible Accessible
+	// Flags are derived from the constraints in Description on a best-effort
+	// basis, since Security.framework has no public API to read them. Only
+	// UserPresence, BiometryAny, BiometryCurrentSet and DevicePasscode are
+	// recognized.
+	Flags AccessControlFlags
+	// Unrecognized is set if Description has constraints that couldn't be
+	// mapped to Flags, e.g. Or, And, ApplicationPassword or PrivateKeyUsage.
+	// Flags are then incomplete and the item may be more protected than they
+	// suggest.
+	Unrecognized bool
+	// Description is the Security.framework description of the access control
+	Description string
+}
+
+// cfTypeToAccessControl converts a SecAccessControlRef.
+func cfTypeToAccessControl(v C.CFTypeRef) *AccessControl {
+	cfDesc := C.CFCopyDescription(v)
+	if cfDesc == 0 {
+		return nil
+	}
+	defer Release(C.CFTypeRef(cfDesc))
+	ac := AccessControl{Description: CFStringToString(cfDesc)}
+
+	// The description looks like
+	// "<SecAccessControlRef: ak;od(cpo(DeviceOwnerAuthentication));...>"
+	desc := strings.TrimPrefix(strings.TrimSuffix(ac.Description, ">"), "<SecAccessControlRef: ")
+	protection := strings.SplitN(desc, ";", 2)[0]
+	for accessible, ref := range accessibleTypeRef {
+		if CFStringToString(C.CFStringRef(ref)) == protection {
+			ac.Accessible = accessible
+		}
+	}
+	ac.Flags, ac.Unrecognized = parseAccessControlConstraints(strings.TrimPrefix(desc, protection))
+	return &ac
+}
+
+// parseAccessControlConstraints maps the operation constraints of an access
+// control description, like ";od(cpo(DeviceOwnerAuthentication));odel(true)",
+// to flags. Operations that are allowed unconditionally ("true") carry no
+// constraint. Only a single recognized constraint on the decrypt operation
+// ("od") maps to a flag; anything else is reported as unrecognized.
+func parseAccessControlConstraints(s string) (flags AccessControlFlags, unrecognized bool) {
+	for _, op := range splitConstraints(s) {
+		if op == "" {
+			continue
+		}
+		name, value, ok := cutConstraint(op)
+		if !ok {
+			unrecognized = true
+			continue
+		}
+		if value == "true" {
+			continue
+		}
+		if name != "od" {
+			unrecognized = true
+			continue
+		}
+		constraint, args, ok := cutConstraint(value)
+		switch {
+		case !ok || len(splitConstraints(value)) != 1:
+			unrecognized = true
+		case constraint == "cpo" && args == "DeviceOwnerAuthentication":
+			flags |= AccessControlUserPresence
+		case constraint == "cup":
+			flags |= AccessControlDevicePasscode
+		case constraint == "cbio" && strings.Contains(args, "pbioc("):
+			flags |= AccessControlBiometryCurrentSet
+		case constraint == "cbio":
+			flags |= AccessControlBiometryAny
+		default:
+			unrecognized = true
+		}
+	}
+	return flags, unrecognized
+}
+
+// splitConstraints splits s at the semicolons that aren't nested in
+// parentheses.
+func splitConstraints(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ';':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// cutConstraint splits "name(value)" into name and value.
+func cutConstraint(s string) (name, value string, ok bool) {
+	name, value, ok = strings.Cut(s, "(")
+	if !ok || !strings.HasSuffix(value, ")") {
+		return "", "", false
+	}
+	return name, strings.TrimSuffix(value, ")"), true
+}
+
+// AccessControlKey is key for kSecAttrAccessControl
+var AccessControlKey = attrKey(C.CFTypeRef(C.kSecAttrAccessControl))
+
+// accessControl converts to a SecAccessControlRef
+type accessControl struct {
+	accessible Accessible
+	flags      AccessControlFlags
+}
+
+func (a accessControl) Convert() (C.CFTypeRef, error) {
+	protection, ok := accessibleTypeRef[a.accessible]
+	if !ok {
+		return 0, fmt.Errorf("invalid accessible %d for access control", a.accessible)
+	}
+	var cfErr C.CFErrorRef
+	ref := C.SecAccessControlCreateWithFlags(C.kCFAllocatorDefault, protection, C.SecAccessControlCreateFlags(a.flags), &cfErr) //nolint
+	if ref == 0 {
+		if cfErr == 0 {
+			return 0, fmt.Errorf("SecAccessControlCreateWithFlags failed")
+		}
+		defer Release(C.CFTypeRef(cfErr))
+		return 0, CFErrorError(cfErr)
+	}
+	return C.CFTypeRef(ref), nil
+}
+
+// AuthenticationUI is whether the user may be prompted to authenticate for
+// items protected by access control
+type AuthenticationUI int
+
+const (
+	// AuthenticationUIDefault is the default
+	AuthenticationUIDefault AuthenticationUI = 0
+	// AuthenticationUIAllow allows prompting the user
+	AuthenticationUIAllow = 1
+	// AuthenticationUIFail fails with ErrorInteractionNotAllowed instead of prompting
+	AuthenticationUIFail = 2
+	// AuthenticationUISkip skips items that would require prompting
+	AuthenticationUISkip = 3
+)
+
+// UseAuthenticationUIKey is key type for AuthenticationUI
+var UseAuthenticationUIKey = attrKey(C.CFTypeRef(C.kSecUseAuthenticationUI))
+var authenticationUITypeRef = map[AuthenticationUI]C.CFTypeRef{
+	AuthenticationUIAllow: C.CFTypeRef(C.kSecUseAuthenticationUIAllow),
+	AuthenticationUIFail:  C.CFTypeRef(C.kSecUseAuthenticationUIFail),
+	AuthenticationUISkip:  C.CFTypeRef(C.kSecUseAuthenticationUISkip),
+}
+
+// UseOperationPromptKey is key type for kSecUseOperationPrompt
+var UseOperationPromptKey = attrKey(C.CFTypeRef(C.kSecUseOperationPrompt))
+
 // MatchLimit is whether to limit results on query
 type MatchLimit int
 
@@ -250,6 +706,18 @@ var matchTypeRef = map[MatchLimit]C.CFTypeRef{
 	MatchLimitAll: C.CFTypeRef(C.kSecMatchLimitAll),
 }
 
+// MatchValidOnDateKey is key type for kSecMatchValidOnDate
+var MatchValidOnDateKey = attrKey(C.CFTypeRef(C.kSecMatchValidOnDate))
+
+// MatchCaseInsensitiveKey is key type for kSecMatchCaseInsensitive
+var MatchCaseInsensitiveKey = attrKey(C.CFTypeRef(C.kSecMatchCaseInsensitive))
+
+// MatchPolicyKey is key type for kSecMatchPolicy
+var MatchPolicyKey = attrKey(C.CFTypeRef(C.kSecMatchPolicy))
+
+// MatchTrustedOnlyKey is key type for kSecMatchTrustedOnly
+var MatchTrustedOnlyKey = attrKey(C.CFTypeRef(C.kSecMatchTrustedOnly))
+
 // ReturnAttributesKey is key type for kSecReturnAttributes
 var ReturnAttributesKey = attrKey(C.CFTypeRef(C.kSecReturnAttributes))
 
@@ -259,10 +727,34 @@ var ReturnDataKey = attrKey(C.CFTypeRef(C.kSecReturnData))
 // ReturnRefKey is key type for kSecReturnRef
 var ReturnRefKey = attrKey(C.CFTypeRef(C.kSecReturnRef))
 
-// Item for adding, querying or deleting.
+// ReturnPersistentRefKey is key type for kSecReturnPersistentRef
+var ReturnPersistentRefKey = attrKey(C.CFTypeRef(C.kSecReturnPersistentRef))
+
+// ValueRefKey is key type for kSecValueRef
+var ValueRefKey = attrKey(C.CFTypeRef(C.kSecValueRef))
+
+// ValuePersistentRefKey is key type for kSecValuePersistentRef
+var ValuePersistentRefKey = attrKey(C.CFTypeRef(C.kSecValuePersistentRef))
+
+// MatchItemListKey is key type for kSecMatchItemList
+var MatchItemListKey = attrKey(C.CFTypeRef(C.kSecMatchItemList))
+
+// Item for adding, querying or deleting. An Item is not safe to modify
+// concurrently, but operations on it don't modify it, so a built Item can be
+// used by concurrent operations.
 type Item struct {
-	// Values can be string, []byte, Convertable or CFTypeRef (constant).
+	// Values can be string, []byte, bool, numbers, time.Time, Convertable or
+	// CFTypeRef (constant).
 	attr map[string]interface{}
+
+	// Date ranges QueryItem results are filtered by, if not zero.
+	createdAfter   time.Time
+	createdBefore  time.Time
+	modifiedAfter  time.Time
+	modifiedBefore time.Time
+
+	// wipeableData is set by SetReturnWipeableData.
+	wipeableData bool
 }
 
 // SetSecClass sets the security class
@@ -279,6 +771,16 @@ func (k *Item) SetInt32(key string, v int32) {
 	}
 }
 
+// SetConvertable sets an attribute to a value converted by v, e.g. a custom
+// CF object wrapper. A nil v removes the attribute.
+func (k *Item) SetConvertable(key string, v Convertable) {
+	if v != nil {
+		k.attr[key] = v
+	} else {
+		delete(k.attr, key)
+	}
+}
+
 // SetString sets a string attibute for a string key
 func (k *Item) SetString(key string, s string) {
 	if s != "" {
@@ -288,6 +790,15 @@ func (k *Item) SetString(key string, s string) {
 	}
 }
 
+// SetBytes sets a data attribute for a string key
+func (k *Item) SetBytes(key string, b []byte) {
+	if b != nil {
+		k.attr[key] = b
+	} else {
+		delete(k.attr, key)
+	}
+}
+
 // SetService sets the service attribute (for generic application items)
 func (k *Item) SetService(s string) {
 	k.SetString(ServiceKey, s)
@@ -299,14 +810,14 @@ func (k *Item) SetServer(s string) {
 }
 
 // SetProtocol sets the protocol attribute (for internet password items)
-// Example values are: "htps", "http", "smb "
-func (k *Item) SetProtocol(s string) {
-	k.SetString(ProtocolKey, s)
+// Example values are: ProtocolHTTPS, ProtocolHTTP, ProtocolSMB
+func (k *Item) SetProtocol(p Protocol) {
+	k.SetString(ProtocolKey, string(p))
 }
 
 // SetAuthenticationType sets the authentication type attribute (for internet password items)
-func (k *Item) SetAuthenticationType(s string) {
-	k.SetString(AuthenticationTypeKey, s)
+func (k *Item) SetAuthenticationType(a AuthenticationType) {
+	k.SetString(AuthenticationTypeKey, string(a))
 }
 
 // SetPort sets the port attribute (for internet password items)
@@ -339,21 +850,106 @@ func (k *Item) SetComment(s string) {
 	k.SetString(CommentKey, s)
 }
 
+// SetGeneric sets the generic attribute (for generic password items), which
+// holds arbitrary user-defined data
+func (k *Item) SetGeneric(b []byte) {
+	k.SetBytes(GenericKey, b)
+}
+
+// SetCreator sets the creator attribute
+func (k *Item) SetCreator(c FourCharCode) {
+	k.SetInt32(CreatorKey, int32(c))
+}
+
+// SetType sets the item type attribute
+func (k *Item) SetType(c FourCharCode) {
+	k.SetInt32(TypeKey, int32(c))
+}
+
 // SetData sets the data attribute
 func (k *Item) SetData(b []byte) {
-	if b != nil {
-		k.attr[DataKey] = b
+	k.SetBytes(DataKey, b)
+}
+
+// SetCompressedData sets the data, compressed with CompressData if it's at
+// least threshold bytes. Compressed data is marked by setting the type
+// attribute to CompressedDataType, so it can't be used with SetType, and
+// QueryItem decompresses generic and internet password data with that type.
+func (k *Item) SetCompressedData(b []byte, threshold int) error {
+	data, compressed, err := CompressData(b, threshold)
+	if err != nil {
+		return err
+	}
+	k.SetData(data)
+	if compressed {
+		k.SetType(CompressedDataType)
+	} else if t, _ := k.attr[TypeKey].(int32); FourCharCode(t) == CompressedDataType {
+		delete(k.attr, TypeKey)
+	}
+	return nil
+}
+
+// SetSubject sets the DER-encoded X.500 subject name attribute (for certificate items)
+func (k *Item) SetSubject(b []byte) {
+	k.SetBytes(SubjectKey, b)
+}
+
+// SetIssuer sets the DER-encoded X.500 issuer name attribute (for certificate items)
+func (k *Item) SetIssuer(b []byte) {
+	k.SetBytes(IssuerKey, b)
+}
+
+// SetSerialNumber sets the DER-encoded serial number attribute (for certificate items)
+func (k *Item) SetSerialNumber(b []byte) {
+	k.SetBytes(SerialNumberKey, b)
+}
+
+// SetSubjectKeyID sets the subject key identifier attribute (for certificate items)
+func (k *Item) SetSubjectKeyID(b []byte) {
+	k.SetBytes(SubjectKeyIDKey, b)
+}
+
+// SetApplicationTag sets the application tag attribute (for key items)
+func (k *Item) SetApplicationTag(b []byte) {
+	k.SetBytes(ApplicationTagKey, b)
+}
+
+// SetApplicationLabel sets the application label attribute (for key items).
+// For public/private key pairs this is the hash of the public key, which
+// matches the PublicKeyHash of the corresponding certificate.
+func (k *Item) SetApplicationLabel(b []byte) {
+	k.SetBytes(ApplicationLabelKey, b)
+}
+
+// SetKeySizeInBits sets the key size attribute (for key items)
+func (k *Item) SetKeySizeInBits(bits int) {
+	if bits != 0 {
+		k.attr[KeySizeInBitsKey] = bits
 	} else {
-		delete(k.attr, DataKey)
+		delete(k.attr, KeySizeInBitsKey)
 	}
 }
 
+// SetIsPermanent sets whether a generated or imported key is stored in the
+// keychain (for key items)
+func (k *Item) SetIsPermanent(b bool) {
+	k.attr[IsPermanentKey] = b
+}
+
+// SetTokenID sets the token ID attribute, which identifies the CryptoTokenKit
+// token (such as a smart card) providing an item
+func (k *Item) SetTokenID(tokenID string) {
+	k.SetString(TokenIDKey, tokenID)
+}
+
 // SetAccessGroup sets the access group attribute
 func (k *Item) SetAccessGroup(ag string) {
 	k.SetString(AccessGroupKey, ag)
 }
 
-// SetSynchronizable sets the synchronizable attribute
+// SetSynchronizable sets the synchronizable attribute. Queries only match
+// non-synchronizable items unless this is set; use SynchronizableAny to match
+// both and report each result's status in QueryResult.Synchronizable.
 func (k *Item) SetSynchronizable(sync Synchronizable) {
 	if sync != SynchronizableDefault {
 		k.attr[SynchronizableKey] = syncTypeRef[sync]
@@ -371,6 +967,34 @@ func (k *Item) SetAccessible(accessible Accessible) {
 	}
 }
 
+// SetAccessControl sets the access control attribute, which replaces the
+// accessible attribute. On macOS, access control requires the data
+// protection keychain.
+func (k *Item) SetAccessControl(accessible Accessible, flags AccessControlFlags) {
+	if accessible != AccessibleDefault {
+		delete(k.attr, AccessibleKey)
+		k.attr[AccessControlKey] = accessControl{accessible: accessible, flags: flags}
+	} else {
+		delete(k.attr, AccessControlKey)
+	}
+}
+
+// SetUseAuthenticationUI sets whether the user may be prompted to
+// authenticate on query
+func (k *Item) SetUseAuthenticationUI(authenticationUI AuthenticationUI) {
+	if authenticationUI != AuthenticationUIDefault {
+		k.attr[UseAuthenticationUIKey] = authenticationUITypeRef[authenticationUI]
+	} else {
+		delete(k.attr, UseAuthenticationUIKey)
+	}
+}
+
+// SetUseOperationPrompt sets the message shown to the user when prompted to
+// authenticate on query
+func (k *Item) SetUseOperationPrompt(prompt string) {
+	k.SetString(UseOperationPromptKey, prompt)
+}
+
 // SetMatchLimit sets the match limit
 func (k *Item) SetMatchLimit(matchLimit MatchLimit) {
 	if matchLimit != MatchLimitDefault {
@@ -380,6 +1004,64 @@ func (k *Item) SetMatchLimit(matchLimit MatchLimit) {
 	}
 }
 
+// SetMatchValidOnDate limits certificate and identity queries to those
+// valid on the given date
+func (k *Item) SetMatchValidOnDate(t time.Time) {
+	if !t.IsZero() {
+		k.attr[MatchValidOnDateKey] = t
+	} else {
+		delete(k.attr, MatchValidOnDateKey)
+	}
+}
+
+// SetMatchCaseInsensitive sets whether string attributes are matched case
+// insensitively on query
+func (k *Item) SetMatchCaseInsensitive(b bool) {
+	k.attr[MatchCaseInsensitiveKey] = b
+}
+
+// SetMatchPolicy limits certificate and identity queries to those valid
+// for the policy
+func (k *Item) SetMatchPolicy(p *Policy) {
+	if p != nil {
+		k.attr[MatchPolicyKey] = p
+	} else {
+		delete(k.attr, MatchPolicyKey)
+	}
+}
+
+// SetMatchTrustedOnly limits certificate and identity queries to trusted
+// certificates
+func (k *Item) SetMatchTrustedOnly(b bool) {
+	k.attr[MatchTrustedOnlyKey] = b
+}
+
+// persistentRefList converts to a CFArray of persistent refs (CFData)
+type persistentRefList [][]byte
+
+func (l persistentRefList) Convert() (C.CFTypeRef, error) {
+	refs := make([]C.CFTypeRef, 0, len(l))
+	for _, b := range l {
+		cfData, err := BytesToCFData(b)
+		if err != nil {
+			return 0, err
+		}
+		defer Release(C.CFTypeRef(cfData))
+		refs = append(refs, C.CFTypeRef(cfData))
+	}
+	return C.CFTypeRef(ArrayToCFArray(refs)), nil
+}
+
+// SetMatchItemList restricts the query to the items with the given
+// persistent references
+func (k *Item) SetMatchItemList(persistentRefs [][]byte) {
+	if len(persistentRefs) > 0 {
+		k.attr[MatchItemListKey] = persistentRefList(persistentRefs)
+	} else {
+		delete(k.attr, MatchItemListKey)
+	}
+}
+
 // SetReturnAttributes sets the return value type on query
 func (k *Item) SetReturnAttributes(b bool) {
 	k.attr[ReturnAttributesKey] = b
@@ -395,9 +1077,106 @@ func (k *Item) SetReturnRef(b bool) {
 	k.attr[ReturnRefKey] = b
 }
 
+// SetReturnPersistentRef enables returning persistent references on query.
+// Use with SetReturnAttributes(true) so the reference is returned in
+// QueryResult.PersistentRef.
+func (k *Item) SetReturnPersistentRef(b bool) {
+	k.attr[ReturnPersistentRefKey] = b
+}
+
+// SetCreatedAfter limits QueryItem results to items created after t.
+// The keychain can't filter by date, so results are filtered after the
+// query: the query must use MatchLimitAll and SetReturnAttributes(true).
+// The filter applies to QueryItem only; other operations return an error
+// if a date filter is set.
+func (k *Item) SetCreatedAfter(t time.Time) {
+	k.createdAfter = t
+}
+
+// SetCreatedBefore limits QueryItem results to items created before t.
+// See SetCreatedAfter.
+func (k *Item) SetCreatedBefore(t time.Time) {
+	k.createdBefore = t
+}
+
+// SetModifiedAfter limits QueryItem results to items modified after t.
+// See SetCreatedAfter.
+func (k *Item) SetModifiedAfter(t time.Time) {
+	k.modifiedAfter = t
+}
+
+// SetModifiedBefore limits QueryItem results to items modified before t.
+// See SetCreatedAfter.
+func (k *Item) SetModifiedBefore(t time.Time) {
+	k.modifiedBefore = t
+}
+
+// SetReturnWipeableData makes QueryItem return data that's the only copy of
+// the plaintext in Go memory, so the caller can zero it with Wipe after use.
+// Buffers used to decompress data (see SetCompressedData) are wiped before
+// QueryItem returns; otherwise they're left to the garbage collector.
+func (k *Item) SetReturnWipeableData(b bool) {
+	k.wipeableData = b
+}
+
+func (k Item) hasDateFilter() bool {
+	return !k.createdAfter.IsZero() || !k.createdBefore.IsZero() ||
+		!k.modifiedAfter.IsZero() || !k.modifiedBefore.IsZero()
+}
+
+// checkNoDateFilter returns an error if a date filter is set, for operations
+// that can't apply it.
+func (k Item) checkNoDateFilter(op string) error {
+	if k.hasDateFilter() {
+		return fmt.Errorf("%s doesn't support date filters; use QueryItem", op)
+	}
+	return nil
+}
+
+// validateDateFilter checks that a query with a date filter returns every
+// match with its attributes, so the results can be filtered.
+func (k Item) validateDateFilter() error {
+	if !k.hasDateFilter() {
+		return nil
+	}
+	if limit, ok := k.attr[MatchLimitKey].(C.CFTypeRef); !ok || limit != matchTypeRef[MatchLimitAll] {
+		return fmt.Errorf("date filters require MatchLimitAll")
+	}
+	if returnAttributes, _ := k.attr[ReturnAttributesKey].(bool); !returnAttributes {
+		return fmt.Errorf("date filters require SetReturnAttributes(true)")
+	}
+	return nil
+}
+
+func (k *Item) matchesDateFilter(r QueryResult) bool {
+	if !k.createdAfter.IsZero() && !r.CreationDate.After(k.createdAfter) {
+		return false
+	}
+	if !k.createdBefore.IsZero() && !r.CreationDate.Before(k.createdBefore) {
+		return false
+	}
+	if !k.modifiedAfter.IsZero() && !r.ModificationDate.After(k.modifiedAfter) {
+		return false
+	}
+	if !k.modifiedBefore.IsZero() && !r.ModificationDate.Before(k.modifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// clone returns a copy of the item that can be modified without changing k.
+func (k *Item) clone() Item {
+	c := *k
+	c.attr = make(map[string]interface{}, len(k.attr))
+	for key, v := range k.attr {
+		c.attr[key] = v
+	}
+	return c
+}
+
 // NewItem is a new empty keychain item
 func NewItem() Item {
-	return Item{make(map[string]interface{})}
+	return Item{attr: make(map[string]interface{})}
 }
 
 // NewGenericPassword creates a generic password item with the default keychain. This is a convenience method.
@@ -412,8 +1191,66 @@ func NewGenericPassword(service string, account string, label string, data []byt
 	return item
 }
 
+// NewInternetPassword creates an internet password item with the default keychain. This is a convenience method.
+func NewInternetPassword(server string, account string, protocol Protocol, port int32, path string, label string, data []byte, accessGroup string) Item {
+	item := NewItem()
+	item.SetSecClass(SecClassInternetPassword)
+	item.SetServer(server)
+	item.SetAccount(account)
+	item.SetProtocol(protocol)
+	item.SetPort(port)
+	item.SetPath(path)
+	item.SetLabel(label)
+	item.SetData(data)
+	item.SetAccessGroup(accessGroup)
+	return item
+}
+
+// requiredKeys are the attributes an item of the class must have to be added.
+var requiredKeys = map[SecClass][]struct{ key, name string }{
+	SecClassGenericPassword:  {{ServiceKey, "service"}},
+	SecClassInternetPassword: {{ServerKey, "server"}},
+}
+
+// Validate checks the item for missing class-specific attributes and
+// incompatible settings. AddItem calls Validate before adding the item.
+func (k Item) Validate() error {
+	sc, ok := k.secClass()
+	if !ok {
+		return fmt.Errorf("missing or unknown class")
+	}
+	for _, required := range requiredKeys[sc] {
+		if _, ok := k.attr[required.key]; !ok {
+			return fmt.Errorf("%s items require a %s", sc, required.name)
+		}
+	}
+	return k.validateCombinations()
+}
+
+// validateCombinations checks for attributes that can't be used together.
+func (k Item) validateCombinations() error {
+	if _, ok := k.attr[AccessibleKey]; ok {
+		if _, ok := k.attr[AccessControlKey]; ok {
+			return fmt.Errorf("accessible and access control attributes can't both be set")
+		}
+	}
+	if returnData, _ := k.attr[ReturnDataKey].(bool); returnData {
+		if limit, ok := k.attr[MatchLimitKey].(C.CFTypeRef); ok && limit == matchTypeRef[MatchLimitAll] {
+			return fmt.Errorf("data can't be returned with MatchLimitAll")
+		}
+	}
+	return nil
+}
+
 // AddItem adds a Item to a Keychain
 func AddItem(item Item) error {
+	if err := item.Validate(); err != nil {
+		return err
+	}
+	if err := item.checkNoDateFilter("AddItem"); err != nil {
+		return err
+	}
+	debugQuery("SecItemAdd", item.attr)
 	cfDict, err := ConvertMapToCFDictionary(item.attr)
 	if err != nil {
 		return err
@@ -425,48 +1262,259 @@ func AddItem(item Item) error {
 	return err
 }
 
-// UpdateItem updates the queryItem with the parameters from updateItem
-func UpdateItem(queryItem Item, updateItem Item) error {
-	cfDict, err := ConvertMapToCFDictionary(queryItem.attr)
-	if err != nil {
-		return err
+// AddItems adds the items, returning an error for each item (nil if it was
+// added). All items are validated and converted before any is added, so an
+// invalid item doesn't leave the batch partially added. Returns nil if every
+// item was added.
+func AddItems(items []Item) []error {
+	errs := make([]error, len(items))
+	failed := false
+	cfDicts := make([]C.CFDictionaryRef, len(items))
+	for i, item := range items {
+		err := item.Validate()
+		if err == nil {
+			err = item.checkNoDateFilter("AddItems")
+		}
+		if err != nil {
+			errs[i] = err
+			failed = true
+			continue
+		}
+		debugQuery("SecItemAdd", item.attr)
+		cfDict, err := ConvertMapToCFDictionary(item.attr)
+		if err != nil {
+			errs[i] = err
+			failed = true
+			continue
+		}
+		cfDicts[i] = cfDict
 	}
-	defer Release(C.CFTypeRef(cfDict))
-	cfDictUpdate, err := ConvertMapToCFDictionary(updateItem.attr)
-	if err != nil {
-		return err
+	defer func() {
+		for _, cfDict := range cfDicts {
+			if cfDict != 0 {
+				Release(C.CFTypeRef(cfDict))
+			}
+		}
+	}()
+	if failed {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = fmt.Errorf("not added: another item in the batch is invalid")
+			}
+		}
+		return errs
 	}
-	defer Release(C.CFTypeRef(cfDictUpdate))
-	errCode := C.SecItemUpdate(cfDict, cfDictUpdate)
-	err = checkError(errCode)
-	return err
+
+	for i, cfDict := range cfDicts {
+		if err := checkError(C.SecItemAdd(cfDict, nil)); err != nil {
+			errs[i] = err
+			failed = true
+		}
+	}
+	if !failed {
+		return nil
+	}
+	return errs
 }
 
-// QueryResult stores all possible results from queries.
-// Not all fields are applicable all the time. Results depend on query.
-type QueryResult struct {
-	// For generic application items
-	Service string
+// primaryKeys are the attributes that uniquely identify an item of a class,
+// in addition to the access group and synchronizable attributes.
+var primaryKeys = map[SecClass][]string{
+	SecClassGenericPassword:  {AccountKey, ServiceKey},
+	SecClassInternetPassword: {AccountKey, SecurityDomainKey, ServerKey, ProtocolKey, AuthenticationTypeKey, PortKey, PathKey},
+	SecClassCertificate:      {CertificateTypeKey, IssuerKey, SerialNumberKey},
+	SecClassCryptoKey:        {KeyClassKey, ApplicationLabelKey, ApplicationTagKey, KeyTypeKey, KeySizeInBitsKey, CreatorKey},
+}
+
+// secClass returns the class of the item, if set.
+func (k *Item) secClass() (SecClass, bool) {
+	ref, ok := k.attr[SecClassKey].(C.CFTypeRef)
+	if !ok {
+		return 0, false
+	}
+	for sc, classRef := range secClassTypeRef {
+		if classRef == ref {
+			return sc, true
+		}
+	}
+	return 0, false
+}
+
+// primaryKeyQuery returns a query matching the item by its class's primary
+// key attributes.
+func (k *Item) primaryKeyQuery() (Item, error) {
+	sc, ok := k.secClass()
+	if !ok {
+		return Item{}, fmt.Errorf("item has no class")
+	}
+	keys, ok := primaryKeys[sc]
+	if !ok {
+		return Item{}, fmt.Errorf("no primary key for class %d", sc)
+	}
+	query := NewItem()
+	query.SetSecClass(sc)
+	keys = append(append(keys, AccessGroupKey, SynchronizableKey), useKeys()...)
+	for _, key := range keys {
+		if v, ok := k.attr[key]; ok {
+			query.attr[key] = v
+		}
+	}
+	return query, nil
+}
+
+// useKeys returns the kSecUse* keys, which select the keychain or control
+// authentication. They're only valid in queries, not in the attributes to
+// update.
+func useKeys() []string {
+	return append([]string{UseAuthenticationContextKey, UseAuthenticationUIKey, UseOperationPromptKey}, keychainSelectionKeys()...)
+}
+
+// keychainSelection returns an item with only the keys of k that select the
+// keychain, for operating on items found by a query in the same keychain.
+func (k Item) keychainSelection() Item {
+	item := NewItem()
+	for _, key := range keychainSelectionKeys() {
+		if v, ok := k.attr[key]; ok {
+			item.attr[key] = v
+		}
+	}
+	return item
+}
+
+func isUseKey(key string) bool {
+	for _, k := range useKeys() {
+		if key == k {
+			return true
+		}
+	}
+	return false
+}
+
+// UpsertItem adds the item, or if it already exists, updates it. The
+// existing item is found by the primary key attributes of the item's class,
+// in the keychain selected by the item (see SetUseDataProtectionKeychain).
+func UpsertItem(item Item) error {
+	err := AddItem(item)
+	if !errors.Is(err, ErrorDuplicateItem) {
+		return err
+	}
+	query, err := item.primaryKeyQuery()
+	if err != nil {
+		return err
+	}
+	update := NewItem()
+	for key, v := range item.attr {
+		if key != SecClassKey && !isUseKey(key) {
+			update.attr[key] = v
+		}
+	}
+	return UpdateItem(query, update)
+}
+
+// UpdateItem updates the queryItem with the parameters from updateItem
+func UpdateItem(queryItem Item, updateItem Item) error {
+	if err := updateItem.validateCombinations(); err != nil {
+		return err
+	}
+	if err := queryItem.checkNoDateFilter("UpdateItem"); err != nil {
+		return err
+	}
+	if err := updateItem.checkNoDateFilter("UpdateItem"); err != nil {
+		return err
+	}
+	debugQuery("SecItemUpdate", queryItem.attr)
+	debugQuery("SecItemUpdate attributes", updateItem.attr)
+	cfDict, err := ConvertMapToCFDictionary(queryItem.attr)
+	if err != nil {
+		return err
+	}
+	defer Release(C.CFTypeRef(cfDict))
+	cfDictUpdate, err := ConvertMapToCFDictionary(updateItem.attr)
+	if err != nil {
+		return err
+	}
+	defer Release(C.CFTypeRef(cfDictUpdate))
+	errCode := C.SecItemUpdate(cfDict, cfDictUpdate)
+	err = checkError(errCode)
+	return err
+}
+
+// QueryResult stores all possible results from queries.
+// Not all fields are applicable all the time. Results depend on query.
+type QueryResult struct {
+	// For generic application items
+	Service string
+	Generic []byte
 
 	// For internet password items
 	Server             string
-	Protocol           string
-	AuthenticationType string
+	Protocol           Protocol
+	AuthenticationType AuthenticationType
 	Port               int32
 	Path               string
 
-	Account          string
-	AccessGroup      string
-	Label            string
-	Description      string
-	Comment          string
-	Data             []byte
+	Account     string
+	AccessGroup string
+	Label       string
+	Description string
+	Comment     string
+	Data        []byte
+	// DataErr is set if Data was stored compressed (see SetCompressedData)
+	// but couldn't be decompressed, in which case Data is as stored
+	DataErr          error
 	CreationDate     time.Time
 	ModificationDate time.Time
+	Creator          FourCharCode
+	Type             FourCharCode
+
+	// For certificate items
+	Subject      []byte
+	Issuer       []byte
+	SerialNumber []byte
+	SubjectKeyID []byte
+	// PublicKeyHash matches the ApplicationLabel of the certificate's key
+	PublicKeyHash []byte
+
+	// For key items
+	ApplicationTag   []byte
+	ApplicationLabel []byte
+	IsPermanent      bool
+	KeySizeInBits    int
+
+	// TokenID is set for items provided by a token, such as a smart card
+	TokenID string
+
+	Accessible     Accessible
+	Synchronizable Synchronizable
+	AccessControl  *AccessControl
+
+	// PersistentRef is set if SetReturnPersistentRef(true)
+	PersistentRef []byte
+
+	// Certificate is set for certificate items if SetReturnRef(true)
+	Certificate *CertificateRef
+
+	// RawAttributes has every returned attribute that could be converted,
+	// including those without a field above. Values are converted as by
+	// Convert.
+	RawAttributes map[string]interface{}
+}
+
+// Wipe zeroes the data of the result. See Wipe.
+func (r *QueryResult) Wipe() {
+	Wipe(r.Data)
 }
 
 // QueryItemRef returns query result as CFTypeRef. You must release it when you are done.
 func QueryItemRef(item Item) (C.CFTypeRef, error) {
+	if err := item.checkNoDateFilter("QueryItemRef"); err != nil {
+		return 0, err
+	}
+	return queryItemRef(item)
+}
+
+func queryItemRef(item Item) (C.CFTypeRef, error) {
+	debugQuery("SecItemCopyMatching", item.attr)
 	cfDict, err := ConvertMapToCFDictionary(item.attr)
 	if err != nil {
 		return 0, err
@@ -485,9 +1533,99 @@ func QueryItemRef(item Item) (C.CFTypeRef, error) {
 	return resultsRef, nil
 }
 
+// BorrowItemData calls fn with the data of the item matching query, without
+// copying it into Go memory, which avoids copies of large payloads. The
+// slice borrows the returned CFData, so it's only valid until fn returns and
+// must not be modified or retained. Data set with SetCompressedData is
+// passed as stored; see DecompressData. Returns ErrorItemNotFound if no item
+// matches.
+func BorrowItemData(query Item, fn func(data []byte) error) error {
+	q := query.clone()
+	q.SetMatchLimit(MatchLimitOne)
+	q.SetReturnData(true)
+	delete(q.attr, ReturnAttributesKey)
+	delete(q.attr, ReturnRefKey)
+	delete(q.attr, ReturnPersistentRefKey)
+	ref, err := QueryItemRef(q)
+	if err != nil {
+		return err
+	}
+	if ref == 0 {
+		return ErrorItemNotFound
+	}
+	defer Release(ref)
+	if C.CFGetTypeID(ref) != C.CFDataGetTypeID() {
+		return fmt.Errorf("Invalid result type: %s", CFTypeDescription(ref))
+	}
+	return fn(borrowCFDataBytes(C.CFDataRef(ref)))
+}
+
+// ItemExists returns whether an item matching query exists. Only attributes
+// are queried, so the item's data isn't read.
+func ItemExists(query Item) (bool, error) {
+	q := query.clone()
+	q.SetMatchLimit(MatchLimitOne)
+	q.SetReturnAttributes(true)
+	delete(q.attr, DataKey)
+	delete(q.attr, ReturnDataKey)
+	delete(q.attr, ReturnRefKey)
+	results, err := QueryItem(q)
+	if err != nil {
+		return false, err
+	}
+	return len(results) > 0, nil
+}
+
+// ItemStatus is the result of ProbeItem
+type ItemStatus int
+
+const (
+	// ItemNotFound means no item matches
+	ItemNotFound ItemStatus = 0
+	// ItemFound means a matching item exists and is readable without prompting
+	ItemFound = 1
+	// ItemRequiresAuthentication means a matching item exists but reading it
+	// requires the user to authenticate
+	ItemRequiresAuthentication = 2
+)
+
+// ProbeItem returns whether an item matching query exists, without
+// prompting the user to authenticate (e.g. with Touch ID or Face ID) for
+// items protected by access control.
+func ProbeItem(query Item) (ItemStatus, error) {
+	q := query.clone()
+	q.SetMatchLimit(MatchLimitOne)
+	q.SetReturnData(true)
+	q.SetUseAuthenticationUI(AuthenticationUIFail)
+	delete(q.attr, DataKey)
+	delete(q.attr, ReturnAttributesKey)
+	delete(q.attr, ReturnRefKey)
+	results, err := QueryItem(q)
+	if errors.Is(err, ErrorInteractionNotAllowed) {
+		return ItemRequiresAuthentication, nil
+	}
+	if err != nil {
+		return ItemNotFound, err
+	}
+	if len(results) == 0 {
+		return ItemNotFound, nil
+	}
+	return ItemFound, nil
+}
+
 // QueryItem returns a list of query results.
 func QueryItem(item Item) ([]QueryResult, error) {
-	resultsRef, err := QueryItemRef(item)
+	if err := item.validateDateFilter(); err != nil {
+		return nil, err
+	}
+	query := item
+	if returnsCompressibleData(item) {
+		// The type attribute marks compressed data, so it's needed to
+		// decompress the data.
+		query = item.clone()
+		query.SetReturnAttributes(true)
+	}
+	resultsRef, err := queryItemRef(query)
 	if err != nil {
 		return nil, err
 	}
@@ -509,6 +1647,8 @@ func QueryItem(item Item) ([]QueryResult, error) {
 					return nil, err
 				}
 				results = append(results, *item)
+			} else if elementTypeID == C.SecCertificateGetTypeID() {
+				results = append(results, QueryResult{Certificate: newCertificateRef(C.SecCertificateRef(ref))})
 			} else {
 				return nil, fmt.Errorf("invalid result type (If you SetReturnRef(true) you should use QueryItemRef directly)")
 			}
@@ -526,62 +1666,213 @@ func QueryItem(item Item) ([]QueryResult, error) {
 		}
 		item := QueryResult{Data: b}
 		results = append(results, item)
+	} else if typeID == C.SecCertificateGetTypeID() {
+		results = append(results, QueryResult{Certificate: newCertificateRef(C.SecCertificateRef(resultsRef))})
 	} else {
 		return nil, fmt.Errorf("Invalid result type: %s", CFTypeDescription(resultsRef))
 	}
 
-	return results, nil
+	filtered := results[:0]
+	for _, r := range results {
+		if !item.matchesDateFilter(r) {
+			continue
+		}
+		if r.Type == CompressedDataType && r.Data != nil {
+			decompressResultData(&r, item.wipeableData)
+		}
+		filtered = append(filtered, r)
+	}
+	return filtered, nil
+}
+
+// returnsCompressibleData returns whether query returns the data of generic
+// or internet passwords, which may have been set with SetCompressedData.
+// Queries without a class, e.g. by persistent reference, may too.
+func returnsCompressibleData(query Item) bool {
+	if returnData, _ := query.attr[ReturnDataKey].(bool); !returnData {
+		return false
+	}
+	sc, ok := query.secClass()
+	return !ok || sc == SecClassGenericPassword || sc == SecClassInternetPassword
+}
+
+// decompressResultData replaces the data of r, compressed by
+// SetCompressedData, with the decompressed data. If decompressing fails, the
+// data is left as stored and r.DataErr set.
+func decompressResultData(r *QueryResult, wipeable bool) {
+	var data []byte
+	var err error
+	if wipeable {
+		data, err = decompressDataWiping(r.Data)
+	} else {
+		data, err = DecompressData(r.Data)
+	}
+	if err != nil {
+		r.DataErr = fmt.Errorf("failed to decompress data: %w", err)
+		return
+	}
+	if wipeable {
+		Wipe(r.Data)
+	}
+	r.Data = data
+	if _, ok := r.RawAttributes[DataKey]; ok {
+		r.RawAttributes[DataKey] = data
+	}
 }
 
+// attrKey converts a constant CFString key or value to a string and caches
+// it. It must only be used to initialize package variables.
 func attrKey(ref C.CFTypeRef) string {
+	key := CFStringToString(C.CFStringRef(ref))
+	attrKeys[ref] = key
+	attrKeyRefs[key] = ref
+	return key
+}
+
+// attrKeys and attrKeyRefs cache the constant CFStrings converted by attrKey
+// in both directions, so building queries and converting results doesn't
+// convert them again. They're only written during package initialization.
+var (
+	attrKeys    = make(map[C.CFTypeRef]string)
+	attrKeyRefs = make(map[string]C.CFTypeRef)
+)
+
+// keyString converts a CFString dictionary key to a string, using the cache
+// for constant keys. Unlike attrKey, it can be used after initialization.
+func keyString(ref C.CFTypeRef) string {
+	if key, ok := attrKeys[ref]; ok {
+		return key
+	}
 	return CFStringToString(C.CFStringRef(ref))
 }
 
+// convertResult converts a result dictionary. Each value is converted once,
+// and used for both its field and RawAttributes.
 func convertResult(d C.CFDictionaryRef) (*QueryResult, error) {
-	m := CFDictionaryToMap(d)
-	result := QueryResult{}
-	for k, v := range m {
-		switch attrKey(k) {
+	keys, values := cfDictionaryKeysAndValues(d)
+	result := QueryResult{RawAttributes: make(map[string]interface{}, len(keys))}
+	for i, k := range keys {
+		key := keyString(k)
+		v := values[i]
+		val, err := Convert(v)
+		if err == nil {
+			result.RawAttributes[key] = val
+		}
+		str, _ := val.(string)
+		b, _ := val.([]byte)
+		switch key {
 		case ServiceKey:
-			result.Service = CFStringToString(C.CFStringRef(v))
+			result.Service = str
+		case GenericKey:
+			result.Generic = b
 		case ServerKey:
-			result.Server = CFStringToString(C.CFStringRef(v))
+			result.Server = str
 		case ProtocolKey:
-			result.Protocol = CFStringToString(C.CFStringRef(v))
+			result.Protocol = Protocol(str)
 		case AuthenticationTypeKey:
-			result.AuthenticationType = CFStringToString(C.CFStringRef(v))
+			result.AuthenticationType = AuthenticationType(str)
 		case PortKey:
-			val := CFNumberToInterface(C.CFNumberRef(v))
-			result.Port = val.(int32)
+			if port, ok := CFNumberToInt64(C.CFNumberRef(v)); ok {
+				result.Port = int32(port)
+			}
+		case KeySizeInBitsKey:
+			if bits, ok := CFNumberToInt64(C.CFNumberRef(v)); ok {
+				result.KeySizeInBits = int(bits)
+			}
 		case PathKey:
-			result.Path = CFStringToString(C.CFStringRef(v))
+			result.Path = str
 		case AccountKey:
-			result.Account = CFStringToString(C.CFStringRef(v))
+			result.Account = str
 		case AccessGroupKey:
-			result.AccessGroup = CFStringToString(C.CFStringRef(v))
+			result.AccessGroup = str
 		case LabelKey:
-			result.Label = CFStringToString(C.CFStringRef(v))
+			result.Label = str
 		case DescriptionKey:
-			result.Description = CFStringToString(C.CFStringRef(v))
+			result.Description = str
 		case CommentKey:
-			result.Comment = CFStringToString(C.CFStringRef(v))
+			result.Comment = str
 		case DataKey:
-			b, err := CFDataToBytes(C.CFDataRef(v))
-			if err != nil {
-				return nil, err
-			}
 			result.Data = b
+		case SubjectKey:
+			result.Subject = b
+		case IssuerKey:
+			result.Issuer = b
+		case SerialNumberKey:
+			result.SerialNumber = b
+		case SubjectKeyIDKey:
+			result.SubjectKeyID = b
+		case PublicKeyHashKey:
+			result.PublicKeyHash = b
+		case ApplicationLabelKey:
+			result.ApplicationLabel = b
+		case IsPermanentKey:
+			result.IsPermanent, _ = val.(bool)
+		case ApplicationTagKey:
+			result.ApplicationTag = b
+		case TokenIDKey:
+			result.TokenID = str
+		case AccessibleKey:
+			result.Accessible = cfTypeToAccessible(v)
+		case SynchronizableKey:
+			result.Synchronizable = cfTypeToSynchronizable(v)
+		case AccessControlKey:
+			result.AccessControl = cfTypeToAccessControl(v)
+		case ValuePersistentRefKey:
+			result.PersistentRef = b
+		case ValueRefKey:
+			if C.CFGetTypeID(v) == C.SecCertificateGetTypeID() {
+				result.Certificate = newCertificateRef(C.SecCertificateRef(v))
+			}
 		case CreationDateKey:
-			result.CreationDate = CFDateToTime(C.CFDateRef(v))
+			result.CreationDate, _ = val.(time.Time)
 		case ModificationDateKey:
-			result.ModificationDate = CFDateToTime(C.CFDateRef(v))
-			// default:
-			// fmt.Printf("Unhandled key in conversion: %v = %v\n", cfTypeValue(k), cfTypeValue(v))
+			result.ModificationDate, _ = val.(time.Time)
+		case CreatorKey:
+			result.Creator = cfNumberToFourCharCode(C.CFNumberRef(v))
+		case TypeKey:
+			result.Type = cfNumberToFourCharCode(C.CFNumberRef(v))
+		default:
+			logger().Debugf("Unhandled key in conversion: %s", key)
 		}
 	}
 	return &result, nil
 }
 
+func cfTypeToAccessible(v C.CFTypeRef) Accessible {
+	for accessible, ref := range accessibleTypeRef {
+		if C.CFEqual(v, ref) != 0 {
+			return accessible
+		}
+	}
+	return AccessibleDefault
+}
+
+func cfTypeToSynchronizable(v C.CFTypeRef) Synchronizable {
+	if C.CFGetTypeID(v) != C.CFBooleanGetTypeID() {
+		return SynchronizableDefault
+	}
+	if C.CFBooleanGetValue(C.CFBooleanRef(v)) != 0 {
+		return SynchronizableYes
+	}
+	return SynchronizableNo
+}
+
+func cfNumberToFourCharCode(n C.CFNumberRef) FourCharCode {
+	val, _ := CFNumberToInt64(n)
+	return FourCharCode(uint32(val))
+}
+
+// UpdateGenericPassword updates the password data for service and account. This is a convenience method.
+func UpdateGenericPassword(service string, account string, data []byte) error {
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService(service)
+	query.SetAccount(account)
+	update := NewItem()
+	update.SetData(data)
+	return UpdateItem(query, update)
+}
+
 // DeleteGenericPasswordItem removes a generic password item.
 func DeleteGenericPasswordItem(service string, account string) error {
 	item := NewItem()
@@ -593,6 +1884,10 @@ func DeleteGenericPasswordItem(service string, account string) error {
 
 // DeleteItem removes a Item
 func DeleteItem(item Item) error {
+	if err := item.checkNoDateFilter("DeleteItem"); err != nil {
+		return err
+	}
+	debugQuery("SecItemDelete", item.attr)
 	cfDict, err := ConvertMapToCFDictionary(item.attr)
 	if err != nil {
 		return err
@@ -630,6 +1925,8 @@ func GetGenericPasswordAccounts(service string) ([]string, error) {
 
 // GetGenericPassword returns password data for service and account. This is a convenience method.
 // If item is not found returns nil, nil.
+// The data is returned as with SetReturnWipeableData, so the caller can zero
+// it with Wipe after use.
 func GetGenericPassword(service string, account string, label string, accessGroup string) ([]byte, error) {
 	query := NewItem()
 	query.SetSecClass(SecClassGenericPassword)
@@ -639,6 +1936,62 @@ func GetGenericPassword(service string, account string, label string, accessGrou
 	query.SetAccessGroup(accessGroup)
 	query.SetMatchLimit(MatchLimitOne)
 	query.SetReturnData(true)
+	query.SetReturnWipeableData(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > 1 {
+		return nil, fmt.Errorf("Too many results")
+	}
+	if len(results) == 1 {
+		if results[0].DataErr != nil {
+			return nil, results[0].DataErr
+		}
+		return results[0].Data, nil
+	}
+	return nil, nil
+}
+
+// GetItemByPersistentRef returns the attributes, and data if returnData is
+// true, for the item with the persistent reference. This is a convenience
+// method. If item is not found returns nil, nil.
+func GetItemByPersistentRef(persistentRef []byte, returnData bool) (*QueryResult, error) {
+	return getItemByPersistentRef(NewItem(), persistentRef, returnData)
+}
+
+// getItemByPersistentRef is GetItemByPersistentRef in the keychain selected
+// by selection.
+func getItemByPersistentRef(selection Item, persistentRef []byte, returnData bool) (*QueryResult, error) {
+	query := selection.keychainSelection()
+	query.SetBytes(ValuePersistentRefKey, persistentRef)
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnAttributes(true)
+	query.SetReturnData(returnData)
+	results, err := QueryItem(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > 1 {
+		return nil, fmt.Errorf("Too many results")
+	}
+	if len(results) == 1 {
+		return &results[0], nil
+	}
+	return nil, nil
+}
+
+// GetInternetPassword returns password data for server, account, protocol and port. This is a convenience method.
+// If item is not found returns nil, nil.
+func GetInternetPassword(server string, account string, protocol Protocol, port int32) ([]byte, error) {
+	query := NewItem()
+	query.SetSecClass(SecClassInternetPassword)
+	query.SetServer(server)
+	query.SetAccount(account)
+	query.SetProtocol(protocol)
+	query.SetPort(port)
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnData(true)
 	results, err := QueryItem(query)
 	if err != nil {
 		return nil, err
@@ -647,7 +2000,432 @@ func GetGenericPassword(service string, account string, label string, accessGrou
 		return nil, fmt.Errorf("Too many results")
 	}
 	if len(results) == 1 {
+		if results[0].DataErr != nil {
+			return nil, results[0].DataErr
+		}
 		return results[0].Data, nil
 	}
 	return nil, nil
 }
+
+// GetGenericPasswordWithAttributes returns password data and attributes for service and account. This is a convenience method.
+// If item is not found returns nil, nil.
+func GetGenericPasswordWithAttributes(service string, account string) (*QueryResult, error) {
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService(service)
+	query.SetAccount(account)
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnAttributes(true)
+	query.SetReturnData(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > 1 {
+		return nil, fmt.Errorf("Too many results")
+	}
+	if len(results) == 1 {
+		return &results[0], nil
+	}
+	return nil, nil
+}
+
+// secClasses are all item classes, in the order ListItems returns them.
+var secClasses = []SecClass{
+	SecClassGenericPassword,
+	SecClassInternetPassword,
+	SecClassCertificate,
+	SecClassCryptoKey,
+	SecClassIdentity,
+}
+
+// ListItems returns the attributes (but not data) of every item of the class
+// in the access group. If secClass is 0, items of all classes are returned.
+// If accessGroup is empty, items in all access groups are returned.
+func ListItems(secClass SecClass, accessGroup string) ([]QueryResult, error) {
+	classes := secClasses
+	if secClass != 0 {
+		classes = []SecClass{secClass}
+	}
+	var results []QueryResult
+	for _, sc := range classes {
+		query := NewItem()
+		query.SetSecClass(sc)
+		query.SetAccessGroup(accessGroup)
+		query.SetMatchLimit(MatchLimitAll)
+		query.SetReturnAttributes(true)
+		r, err := QueryItem(query)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r...)
+	}
+	return results, nil
+}
+
+// GetTokenIdentities returns the attributes and persistent refs of the
+// identities on attached tokens, such as PIV smart cards. If tokenID is
+// empty, identities on all tokens are returned.
+func GetTokenIdentities(tokenID string) ([]QueryResult, error) {
+	return queryTokenItems(SecClassIdentity, tokenID)
+}
+
+// GetTokenKeys returns the attributes and persistent refs of the keys on
+// attached tokens. If tokenID is empty, keys on all tokens are returned.
+func GetTokenKeys(tokenID string) ([]QueryResult, error) {
+	return queryTokenItems(SecClassCryptoKey, tokenID)
+}
+
+func queryTokenItems(secClass SecClass, tokenID string) ([]QueryResult, error) {
+	query := NewItem()
+	query.SetSecClass(secClass)
+	query.SetAccessGroup(AccessGroupToken)
+	query.SetTokenID(tokenID)
+	query.SetMatchLimit(MatchLimitAll)
+	query.SetReturnAttributes(true)
+	query.SetReturnPersistentRef(true)
+	return QueryItem(query)
+}
+
+// DeleteAllItems deletes every item in the access group of the given
+// classes, including synchronizable items, e.g. to reset the keychain on
+// logout. If no classes are given, items of all classes are deleted. The
+// access group must not be empty.
+func DeleteAllItems(accessGroup string, classes ...SecClass) error {
+	if accessGroup == "" {
+		return fmt.Errorf("DeleteAllItems requires an access group")
+	}
+	if len(classes) == 0 {
+		classes = secClasses
+	}
+	for _, sc := range classes {
+		query := NewItem()
+		query.SetSecClass(sc)
+		query.SetAccessGroup(accessGroup)
+		query.SetSynchronizable(SynchronizableAny)
+		if err := DeleteItem(query); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAccessGroups returns the distinct access groups of the items of all
+// classes the current process can see, sorted. This is useful for debugging
+// entitlement and access group mismatches.
+func GetAccessGroups() ([]string, error) {
+	results, err := ListItems(0, "")
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var groups []string
+	for _, r := range results {
+		if r.AccessGroup != "" && !seen[r.AccessGroup] {
+			seen[r.AccessGroup] = true
+			groups = append(groups, r.AccessGroup)
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// ListSynchronizableItems returns the attributes (but not data) of the items
+// of the class that sync with iCloud Keychain. If accessGroup is empty, items
+// in all access groups are returned.
+func ListSynchronizableItems(secClass SecClass, accessGroup string) ([]QueryResult, error) {
+	query := NewItem()
+	query.SetSecClass(secClass)
+	query.SetAccessGroup(accessGroup)
+	query.SetSynchronizable(SynchronizableYes)
+	query.SetMatchLimit(MatchLimitAll)
+	query.SetReturnAttributes(true)
+	return QueryItem(query)
+}
+
+// SetItemSynchronizable sets whether the items matching query sync with
+// iCloud Keychain. The query matches both synchronizable and
+// non-synchronizable items unless it sets Synchronizable itself.
+func SetItemSynchronizable(query Item, sync bool) error {
+	q := query.clone()
+	if _, ok := q.attr[SynchronizableKey]; !ok {
+		q.SetSynchronizable(SynchronizableAny)
+	}
+	update := NewItem()
+	if sync {
+		update.SetSynchronizable(SynchronizableYes)
+	} else {
+		update.SetSynchronizable(SynchronizableNo)
+	}
+	return UpdateItem(q, update)
+}
+
+// passwordItemFromResult returns an item with the attributes and data of a
+// generic or internet password result, for adding it again to the keychain
+// selected by selection. Access control can't be copied from a result, so
+// the caller must not use it for items with access control.
+func passwordItemFromResult(secClass SecClass, r QueryResult, selection Item) Item {
+	item := selection.keychainSelection()
+	item.SetSecClass(secClass)
+	item.SetService(r.Service)
+	item.SetServer(r.Server)
+	item.SetProtocol(r.Protocol)
+	item.SetAuthenticationType(r.AuthenticationType)
+	item.SetPort(r.Port)
+	item.SetPath(r.Path)
+	item.SetAccount(r.Account)
+	item.SetAccessGroup(r.AccessGroup)
+	item.SetLabel(r.Label)
+	item.SetDescription(r.Description)
+	item.SetComment(r.Comment)
+	item.SetGeneric(r.Generic)
+	item.SetCreator(r.Creator)
+	item.SetType(r.Type)
+	item.SetAccessible(r.Accessible)
+	if r.Synchronizable == SynchronizableYes {
+		item.SetSynchronizable(SynchronizableYes)
+	}
+	item.SetData(r.Data)
+	if r.Type == CompressedDataType && r.DataErr == nil {
+		// The data was decompressed by the query, so compress it again.
+		// Compressing into memory can't fail.
+		_ = item.SetCompressedData(r.Data, 0)
+	}
+	return item
+}
+
+// MigrateAccessible re-saves the generic or internet password items matching
+// query with a new accessibility. The accessibility of an item can't be
+// updated, so each item is deleted and added again; if adding fails, the
+// original item is restored. Items with access control are skipped, since
+// their accessibility is part of the access control. Returns the number of
+// items migrated.
+func MigrateAccessible(query Item, newAccessible Accessible) (int, error) {
+	secClass, ok := query.secClass()
+	if !ok || (secClass != SecClassGenericPassword && secClass != SecClassInternetPassword) {
+		return 0, fmt.Errorf("MigrateAccessible requires a generic or internet password query")
+	}
+	q := query.clone()
+	q.SetMatchLimit(MatchLimitAll)
+	q.SetReturnAttributes(true)
+	q.SetReturnPersistentRef(true)
+	delete(q.attr, ReturnDataKey)
+	results, err := QueryItem(q)
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, r := range results {
+		if r.Accessible == newAccessible || r.AccessControl != nil {
+			continue
+		}
+		withData, err := getItemByPersistentRef(query, r.PersistentRef, true)
+		if err != nil {
+			return migrated, err
+		}
+		if withData == nil {
+			continue
+		}
+		if withData.AccessControl != nil {
+			withData.Wipe()
+			continue
+		}
+		r.Data = withData.Data
+		err = migrateAccessible(query, secClass, r, newAccessible)
+		r.Wipe()
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+func migrateAccessible(query Item, secClass SecClass, r QueryResult, newAccessible Accessible) error {
+	original := passwordItemFromResult(secClass, r, query)
+	item := original.clone()
+	item.SetAccessible(newAccessible)
+	if err := item.Validate(); err != nil {
+		return err
+	}
+
+	ref := query.keychainSelection()
+	ref.SetBytes(ValuePersistentRefKey, r.PersistentRef)
+	if err := DeleteItem(ref); err != nil {
+		return err
+	}
+	if err := AddItem(item); err != nil {
+		if restoreErr := AddItem(original); restoreErr != nil {
+			return fmt.Errorf("%v (restoring original item failed: %v)", err, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// RenameService changes the service of the generic password items for
+// oldService to newService, preserving their other attributes and data. Each
+// item is updated in place; if the keychain rejects the update, a copy is
+// added with the new service and the original deleted. Items with access
+// control can't be copied, so an error is returned if one can't be updated in
+// place. Returns the number of items renamed.
+func RenameService(oldService string, newService string) (int, error) {
+	if newService == "" || newService == oldService {
+		return 0, fmt.Errorf("invalid new service %q", newService)
+	}
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService(oldService)
+	query.SetSynchronizable(SynchronizableAny)
+	query.SetMatchLimit(MatchLimitAll)
+	query.SetReturnAttributes(true)
+	query.SetReturnPersistentRef(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		return 0, err
+	}
+
+	renamed := 0
+	for _, r := range results {
+		ref := NewItem()
+		ref.SetBytes(ValuePersistentRefKey, r.PersistentRef)
+		update := NewItem()
+		update.SetService(newService)
+		err := UpdateItem(ref, update)
+		if errors.Is(err, ErrorDuplicateItem) {
+			return renamed, err
+		}
+		if err != nil {
+			if err := renameByCopy(query, r, newService); err != nil {
+				return renamed, err
+			}
+		}
+		renamed++
+	}
+	return renamed, nil
+}
+
+// renameByCopy adds a copy of the item with the new service, then deletes
+// the original.
+func renameByCopy(query Item, r QueryResult, newService string) error {
+	if r.AccessControl != nil {
+		return fmt.Errorf("can't rename item with access control by copying it")
+	}
+	withData, err := getItemByPersistentRef(query, r.PersistentRef, true)
+	if err != nil {
+		return err
+	}
+	if withData == nil {
+		return ErrorItemNotFound
+	}
+	r.Data = withData.Data
+	defer r.Wipe()
+	item := passwordItemFromResult(SecClassGenericPassword, r, query)
+	item.SetService(newService)
+	if err := AddItem(item); err != nil {
+		return err
+	}
+	ref := query.keychainSelection()
+	ref.SetBytes(ValuePersistentRefKey, r.PersistentRef)
+	return DeleteItem(ref)
+}
+
+// Finding is a problem found by Diagnose
+type Finding struct {
+	// Check is the name of the failing check
+	Check string
+	// Err is the error the check failed with
+	Err error
+	// Advice explains the likely cause and how to fix it
+	Advice string
+}
+
+// diagnosticProbe is an item Diagnose adds and deletes to check that a
+// keychain is usable
+type diagnosticProbe struct {
+	check string
+	item  Item
+}
+
+// Diagnose checks that items can be added to and deleted from the keychains
+// this package uses, and returns a finding for each check that failed with
+// advice for common causes, such as a missing entitlement (-34018) or a
+// locked keychain. No findings means no problems were detected.
+func Diagnose() []Finding {
+	var findings []Finding
+	for _, probe := range diagnosticProbes() {
+		_ = DeleteItem(probe.item)
+		err := AddItem(probe.item)
+		if err == nil {
+			err = DeleteItem(probe.item)
+		}
+		if err != nil {
+			findings = append(findings, Finding{Check: probe.check, Err: err, Advice: diagnosticAdvice(err)})
+		}
+	}
+	return findings
+}
+
+func newDiagnosticItem() Item {
+	return NewGenericPassword("go-keychain diagnostics", "probe", "", []byte("probe"), "")
+}
+
+func diagnosticAdvice(err error) string {
+	switch {
+	case errors.Is(err, ErrorMissingEntitlement):
+		return "The binary is missing the keychain-access-groups or application-identifier entitlement, which the data protection keychain requires. Sign the binary with the entitlement and a provisioning profile, or use the file-based keychain."
+	case errors.Is(err, ErrorInteractionNotAllowed), errors.Is(err, ErrorInteractionRequired):
+		return "The keychain is locked and the user can't be prompted, e.g. in an SSH session or a daemon. Unlock the keychain first."
+	case errors.Is(err, ErrorNoSuchKeychain), errors.Is(err, ErrorNoDefaultKeychain), errors.Is(err, ErrorNotAvailable):
+		return "No default keychain is available. Create one or set the default keychain."
+	case IsPermissionDenied(err), errors.Is(err, ErrorAuthFailed):
+		return "Access was denied, possibly by the App Sandbox or the item's access control. Check the sandbox entitlements and access groups."
+	}
+	return "Unexpected error."
+}
+
+// RetryOptions configures WithRetry
+type RetryOptions struct {
+	// Unlock, if set, is called before each retry, e.g. to unlock the
+	// keychain with Keychain.Unlock (macOS)
+	Unlock func() error
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// Defaults to 3.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, which doubles for each
+	// further retry. Defaults to 100ms.
+	Backoff time.Duration
+}
+
+// WithRetry calls op, and if it fails with ErrorInteractionNotAllowed (e.g.
+// because the keychain is locked and the process can't prompt the user),
+// unlocks and retries it with backoff. Other errors are returned immediately.
+func WithRetry(opts RetryOptions, op func() error) error {
+	attempts := opts.MaxAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+			if opts.Unlock != nil {
+				if unlockErr := opts.Unlock(); unlockErr != nil {
+					return unlockErr
+				}
+			}
+		}
+		err = op()
+		if !errors.Is(err, ErrorInteractionNotAllowed) {
+			return err
+		}
+	}
+	return err
+}
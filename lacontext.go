@@ -0,0 +1,48 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security -framework Foundation -framework LocalAuthentication
+
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+
+#include "lacontext.h"
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// UseAuthenticationContextKey is key for kSecUseAuthenticationContext
+var UseAuthenticationContextKey = attrKey(C.CFTypeRef(C.kSecUseAuthenticationContext))
+
+// applicationPassword converts to an LAContext with the application
+// password credential set
+type applicationPassword []byte
+
+func (p applicationPassword) Convert() (C.CFTypeRef, error) {
+	var ptr unsafe.Pointer
+	if len(p) > 0 {
+		ptr = unsafe.Pointer(&p[0])
+	}
+	ref := C.LAContextCreateWithApplicationPassword(ptr, C.CFIndex(len(p)))
+	if ref == 0 {
+		return 0, fmt.Errorf("failed to set application password credential")
+	}
+	return ref, nil
+}
+
+// SetApplicationPassword sets the application password used to add or read
+// an item protected with AccessControlApplicationPassword, so the user isn't
+// prompted for it.
+func (k *Item) SetApplicationPassword(password []byte) {
+	if password != nil {
+		k.attr[UseAuthenticationContextKey] = applicationPassword(password)
+	} else {
+		delete(k.attr, UseAuthenticationContextKey)
+	}
+}
@@ -0,0 +1,5 @@
+#include <CoreFoundation/CoreFoundation.h>
+
+// LAContextCreateWithApplicationPassword returns a retained LAContext with
+// the application password credential set, or NULL on failure.
+CFTypeRef LAContextCreateWithApplicationPassword(const void *password, CFIndex length);
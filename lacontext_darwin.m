@@ -0,0 +1,14 @@
+#import <Foundation/Foundation.h>
+#import <LocalAuthentication/LocalAuthentication.h>
+
+#include "lacontext.h"
+
+CFTypeRef LAContextCreateWithApplicationPassword(const void *password, CFIndex length) {
+  LAContext *context = [[LAContext alloc] init];
+  NSData *credential = [NSData dataWithBytes:password length:length];
+  if (![context setCredential:credential type:LACredentialTypeApplicationPassword]) {
+    [context release];
+    return NULL;
+  }
+  return (CFTypeRef)context;
+}
@@ -0,0 +1,89 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation
+
+#include <CoreFoundation/CoreFoundation.h>
+*/
+import "C"
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// leakDetector counts the CF objects created or retained by this package that
+// haven't been released yet. enabled is checked before taking the lock, so
+// conversions don't contend on it while detection is disabled.
+var leakDetector struct {
+	sync.Mutex
+	enabled     atomic.Bool
+	outstanding map[C.CFTypeRef]int
+}
+
+// EnableLeakDetection starts counting the CF objects created by this
+// package's conversion functions (e.g. StringToCFString and
+// ConvertMapToCFDictionary) and held by CertificateRef, Policy and TrustRef,
+// until they are released with Release. Use OutstandingCFObjects to report
+// those not yet released, e.g. at the end of a test. It adds overhead, so
+// only enable it when debugging.
+func EnableLeakDetection() {
+	leakDetector.Lock()
+	defer leakDetector.Unlock()
+	leakDetector.outstanding = make(map[C.CFTypeRef]int)
+	leakDetector.enabled.Store(true)
+}
+
+// DisableLeakDetection stops counting CF objects and forgets outstanding
+// ones.
+func DisableLeakDetection() {
+	leakDetector.Lock()
+	defer leakDetector.Unlock()
+	leakDetector.enabled.Store(false)
+	leakDetector.outstanding = nil
+}
+
+// OutstandingCFObjects returns the number of CF objects counted since
+// EnableLeakDetection and not yet released, by type. Objects held by a
+// CertificateRef, Policy or TrustRef are released by its finalizer, so run
+// the garbage collector before checking for leaks of those.
+func OutstandingCFObjects() map[string]int {
+	leakDetector.Lock()
+	defer leakDetector.Unlock()
+	objects := make(map[string]int)
+	for ref, count := range leakDetector.outstanding {
+		objects[CFTypeDescription(ref)] += count
+	}
+	return objects
+}
+
+// trackCF counts a CF object created or retained by this package.
+func trackCF(ref C.CFTypeRef) {
+	if ref == 0 || !leakDetector.enabled.Load() {
+		return
+	}
+	leakDetector.Lock()
+	defer leakDetector.Unlock()
+	if leakDetector.outstanding != nil {
+		leakDetector.outstanding[ref]++
+	}
+}
+
+// untrackCF counts the release of a CF object. Objects that weren't counted
+// by trackCF are ignored.
+func untrackCF(ref C.CFTypeRef) {
+	if !leakDetector.enabled.Load() {
+		return
+	}
+	leakDetector.Lock()
+	defer leakDetector.Unlock()
+	if count, ok := leakDetector.outstanding[ref]; ok {
+		if count <= 1 {
+			delete(leakDetector.outstanding, ref)
+		} else {
+			leakDetector.outstanding[ref] = count - 1
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package keychain
+
+import "github.com/keybase/go-keychain/internal/logging"
+
+// Logger is used by this package to log unexpected but non-fatal conditions.
+// Adapt your logger (e.g. slog or zap) to it and pass it to SetLogger.
+type Logger = logging.Logger
+
+var currentLogger logging.Value
+
+// SetLogger sets the package logger. Logging is disabled by default, or if l
+// is nil.
+func SetLogger(l Logger) {
+	currentLogger.Set(l)
+}
+
+func logger() Logger {
+	return currentLogger.Get()
+}
@@ -5,10 +5,22 @@ package keychain
 
 /*
 #cgo LDFLAGS: -framework CoreFoundation -framework Security
+#include <limits.h>
+#include <stdlib.h>
 #include <CoreFoundation/CoreFoundation.h>
 #include <Security/Security.h>
+
+// SecKeychainChangePassword is exported by Security.framework but only
+// declared in the private SecKeychainPriv.h.
+extern OSStatus SecKeychainChangePassword(SecKeychainRef keychainRef, UInt32 oldPasswordLength, const void *oldPassword, UInt32 newPasswordLength, const void *newPassword);
 */
 import "C"
+import (
+	"fmt"
+	"os"
+	"time"
+	"unsafe"
+)
 
 // AccessibleKey is key for kSecAttrAccessible
 var AccessibleKey = attrKey(C.CFTypeRef(C.kSecAttrAccessible))
@@ -23,3 +35,342 @@ var accessibleTypeRef = map[Accessible]C.CFTypeRef{
 	// Only available in 10.10
 	//AccessibleWhenPasscodeSetThisDeviceOnly:  C.CFTypeRef(C.kSecAttrAccessibleWhenPasscodeSetThisDeviceOnly),
 }
+
+// TrustCopyAnchorCertificates returns the anchor certificates in the system
+// trust store.
+func TrustCopyAnchorCertificates() ([]*CertificateRef, error) {
+	var cfAnchors C.CFArrayRef
+	errCode := C.SecTrustCopyAnchorCertificates(&cfAnchors) //nolint
+	if err := checkOpError("SecTrustCopyAnchorCertificates", errCode); err != nil {
+		return nil, err
+	}
+	defer Release(C.CFTypeRef(cfAnchors))
+	arr := CFArrayToArray(cfAnchors)
+	anchors := make([]*CertificateRef, 0, len(arr))
+	for _, ref := range arr {
+		anchors = append(anchors, newCertificateRef(C.SecCertificateRef(ref)))
+	}
+	return anchors, nil
+}
+
+// MatchDiacriticInsensitiveKey is key type for kSecMatchDiacriticInsensitive
+var MatchDiacriticInsensitiveKey = attrKey(C.CFTypeRef(C.kSecMatchDiacriticInsensitive))
+
+// MatchWidthInsensitiveKey is key type for kSecMatchWidthInsensitive
+var MatchWidthInsensitiveKey = attrKey(C.CFTypeRef(C.kSecMatchWidthInsensitive))
+
+// SetMatchDiacriticInsensitive sets whether string attributes are matched
+// ignoring diacritics on query
+func (k *Item) SetMatchDiacriticInsensitive(b bool) {
+	k.attr[MatchDiacriticInsensitiveKey] = b
+}
+
+// SetMatchWidthInsensitive sets whether string attributes are matched
+// ignoring character width (e.g. full-width vs half-width) on query
+func (k *Item) SetMatchWidthInsensitive(b bool) {
+	k.attr[MatchWidthInsensitiveKey] = b
+}
+
+// AccessControlWatch requires a paired Apple Watch (macOS only)
+const AccessControlWatch AccessControlFlags = C.kSecAccessControlWatch
+
+// UseDataProtectionKeychainKey is key for kSecUseDataProtectionKeychain
+var UseDataProtectionKeychainKey = attrKey(C.CFTypeRef(C.kSecUseDataProtectionKeychain))
+
+// SetUseDataProtectionKeychain sets whether the item is added to, queried
+// from or deleted from the data protection (iOS-style) keychain instead of
+// the file-based keychain. Access groups and access control only work with
+// the data protection keychain. Requires macOS 10.15.
+func (k *Item) SetUseDataProtectionKeychain(b bool) {
+	if b {
+		k.attr[UseDataProtectionKeychainKey] = true
+	} else {
+		delete(k.attr, UseDataProtectionKeychainKey)
+	}
+}
+
+// keychainSelectionKeys returns the query keys that select which keychain
+// an item is in.
+func keychainSelectionKeys() []string {
+	return []string{UseDataProtectionKeychainKey}
+}
+
+// keychainSelections returns a query item selecting each keychain: the
+// file-based keychain and the data protection keychain.
+func keychainSelections() []Item {
+	dataProtection := NewItem()
+	dataProtection.SetUseDataProtectionKeychain(true)
+	return []Item{NewItem(), dataProtection}
+}
+
+func diagnosticProbes() []diagnosticProbe {
+	dataProtection := newDiagnosticItem()
+	dataProtection.SetUseDataProtectionKeychain(true)
+	return []diagnosticProbe{
+		{check: "file-based keychain", item: newDiagnosticItem()},
+		{check: "data protection keychain", item: dataProtection},
+	}
+}
+
+// MigrationResult is the result of migrating an item to the data protection
+// keychain
+type MigrationResult struct {
+	// Item has the attributes of the original item (but not data)
+	Item QueryResult
+	// Err is set if the item couldn't be migrated
+	Err error
+}
+
+// MigrateToDataProtectionKeychain copies the generic and internet password
+// items matching query from the file-based keychains to the data protection
+// keychain, preserving their attributes. If query has no class, items of both
+// classes are migrated. Items are added to the app's default access group. If
+// deleteOriginals is true, each original item is deleted once it has been
+// copied. Returns the result of each item; an error is only returned if the
+// items couldn't be queried.
+func MigrateToDataProtectionKeychain(query Item, deleteOriginals bool) ([]MigrationResult, error) {
+	classes := []SecClass{SecClassGenericPassword, SecClassInternetPassword}
+	if secClass, ok := query.secClass(); ok {
+		classes = []SecClass{secClass}
+	}
+	var migrations []MigrationResult
+	for _, secClass := range classes {
+		q := query.clone()
+		q.SetSecClass(secClass)
+		q.SetUseDataProtectionKeychain(false)
+		q.SetMatchLimit(MatchLimitAll)
+		q.SetReturnAttributes(true)
+		q.SetReturnPersistentRef(true)
+		delete(q.attr, ReturnDataKey)
+		results, err := QueryItem(q)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			migrations = append(migrations, MigrationResult{
+				Item: r,
+				Err:  migrateToDataProtectionKeychain(secClass, r, deleteOriginals),
+			})
+		}
+	}
+	return migrations, nil
+}
+
+func migrateToDataProtectionKeychain(secClass SecClass, r QueryResult, deleteOriginal bool) error {
+	withData, err := GetItemByPersistentRef(r.PersistentRef, true)
+	if err != nil {
+		return err
+	}
+	if withData == nil {
+		return ErrorItemNotFound
+	}
+	r.Data = withData.Data
+	defer r.Wipe()
+	// Access groups of file-based keychain items don't apply to the data
+	// protection keychain.
+	r.AccessGroup = ""
+	item := passwordItemFromResult(secClass, r, NewItem())
+	item.SetUseDataProtectionKeychain(true)
+	if err := AddItem(item); err != nil {
+		return err
+	}
+	if deleteOriginal {
+		ref := NewItem()
+		ref.SetBytes(ValuePersistentRefKey, r.PersistentRef)
+		return DeleteItem(ref)
+	}
+	return nil
+}
+
+// Keychain is a file-based keychain
+type Keychain struct {
+	// path is the keychain file path, or empty for the default keychain
+	path string
+}
+
+// OpenKeychain returns the keychain at path. If path is empty, the default
+// keychain is used. The keychain doesn't have to exist yet.
+func OpenKeychain(path string) Keychain {
+	return Keychain{path: path}
+}
+
+// KeychainOptions configures NewKeychain
+type KeychainOptions struct {
+	// Password of the new keychain, unless Prompt is set
+	Password string
+	// Prompt prompts the user for the password of the new keychain
+	Prompt bool
+	// Access is the initial access of items added to the keychain. If nil,
+	// only the application creating an item is trusted to read it.
+	Access *Access
+	// LockOnSleep locks the keychain when the computer sleeps
+	LockOnSleep bool
+	// LockInterval locks the keychain after this period of inactivity if not
+	// zero
+	LockInterval time.Duration
+	// AddToSearchList adds the keychain to the user's keychain search list,
+	// so it is searched by queries that don't specify a keychain
+	AddToSearchList bool
+}
+
+// NewKeychain creates a new keychain file at path.
+func NewKeychain(path string, opts KeychainOptions) (Keychain, error) {
+	var initialAccess C.SecAccessRef
+	if opts.Access != nil {
+		var err error
+		initialAccess, err = opts.Access.secAccess()
+		if err != nil {
+			return Keychain{}, err
+		}
+		defer Release(C.CFTypeRef(initialAccess))
+	}
+
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	var promptUser C.Boolean = C.false
+	var cPassword *C.char
+	if opts.Prompt {
+		promptUser = C.true
+	} else {
+		cPassword = C.CString(opts.Password)
+		defer C.free(unsafe.Pointer(cPassword))
+	}
+	var ref C.SecKeychainRef
+	errCode := C.SecKeychainCreate(cPath, C.UInt32(len(opts.Password)), unsafe.Pointer(cPassword), promptUser, initialAccess, &ref) //nolint
+	if err := checkOpError("SecKeychainCreate", errCode); err != nil {
+		return Keychain{}, err
+	}
+	defer Release(C.CFTypeRef(ref))
+
+	if opts.LockOnSleep || opts.LockInterval > 0 {
+		var settings C.SecKeychainSettings
+		settings.version = C.SEC_KEYCHAIN_SETTINGS_VERS1
+		if opts.LockOnSleep {
+			settings.lockOnSleep = C.true
+		}
+		if opts.LockInterval > 0 {
+			settings.useLockInterval = C.true
+			settings.lockInterval = C.UInt32(opts.LockInterval / time.Second)
+		} else {
+			// Without a lock interval the keychain stays unlocked.
+			settings.lockInterval = C.INT_MAX
+		}
+		if err := checkOpError("SecKeychainSetSettings", C.SecKeychainSetSettings(ref, &settings)); err != nil { //nolint
+			return Keychain{}, err
+		}
+	}
+
+	if opts.AddToSearchList {
+		if err := addToSearchList(ref); err != nil {
+			return Keychain{}, err
+		}
+	}
+	return Keychain{path: path}, nil
+}
+
+func addToSearchList(ref C.SecKeychainRef) error {
+	var searchList C.CFArrayRef
+	if err := checkOpError("SecKeychainCopySearchList", C.SecKeychainCopySearchList(&searchList)); err != nil { //nolint
+		return err
+	}
+	defer Release(C.CFTypeRef(searchList))
+	keychains := append(CFArrayToArray(searchList), C.CFTypeRef(ref))
+	newSearchList := ArrayToCFArray(keychains)
+	defer Release(C.CFTypeRef(newSearchList))
+	return checkOpError("SecKeychainSetSearchList", C.SecKeychainSetSearchList(newSearchList))
+}
+
+// ref returns the SecKeychainRef for the keychain, or 0 for the default
+// keychain. If non-zero, it must be released with Release(ref).
+func (kc Keychain) ref() (C.SecKeychainRef, error) {
+	if kc.path == "" {
+		return 0, nil
+	}
+	path := C.CString(kc.path)
+	defer C.free(unsafe.Pointer(path))
+	var ref C.SecKeychainRef
+	if err := checkOpError("SecKeychainOpen", C.SecKeychainOpen(path, &ref)); err != nil { //nolint
+		return 0, err
+	}
+	return ref, nil
+}
+
+// Unlock unlocks the keychain with password. If prompt is true, the user is
+// prompted for the password instead.
+func (kc Keychain) Unlock(password string, prompt bool) error {
+	ref, err := kc.ref()
+	if err != nil {
+		return err
+	}
+	if ref != 0 {
+		defer Release(C.CFTypeRef(ref))
+	}
+	if prompt {
+		return checkOpError("SecKeychainUnlock", C.SecKeychainUnlock(ref, 0, nil, C.false)) //nolint
+	}
+	cPassword := C.CString(password)
+	defer C.free(unsafe.Pointer(cPassword))
+	errCode := C.SecKeychainUnlock(ref, C.UInt32(len(password)), unsafe.Pointer(cPassword), C.true) //nolint
+	return checkOpError("SecKeychainUnlock", errCode)
+}
+
+// KeychainStatus is the status of a keychain
+type KeychainStatus struct {
+	Unlocked bool
+	Readable bool
+	Writable bool
+}
+
+// Status returns whether the keychain is unlocked, readable and writable.
+func (kc Keychain) Status() (KeychainStatus, error) {
+	ref, err := kc.ref()
+	if err != nil {
+		return KeychainStatus{}, err
+	}
+	if ref != 0 {
+		defer Release(C.CFTypeRef(ref))
+	}
+	var status C.SecKeychainStatus
+	if err := checkOpError("SecKeychainGetStatus", C.SecKeychainGetStatus(ref, &status)); err != nil { //nolint
+		return KeychainStatus{}, err
+	}
+	return KeychainStatus{
+		Unlocked: status&C.kSecUnlockStateStatus != 0,
+		Readable: status&C.kSecReadPermStatus != 0,
+		Writable: status&C.kSecWritePermStatus != 0,
+	}, nil
+}
+
+// ChangePassword changes the password of the keychain.
+func (kc Keychain) ChangePassword(oldPassword string, newPassword string) error {
+	ref, err := kc.ref()
+	if err != nil {
+		return err
+	}
+	if ref != 0 {
+		defer Release(C.CFTypeRef(ref))
+	}
+	cOld := C.CString(oldPassword)
+	defer C.free(unsafe.Pointer(cOld))
+	cNew := C.CString(newPassword)
+	defer C.free(unsafe.Pointer(cNew))
+	errCode := C.SecKeychainChangePassword(ref, C.UInt32(len(oldPassword)), unsafe.Pointer(cOld), C.UInt32(len(newPassword)), unsafe.Pointer(cNew))
+	return checkOpError("SecKeychainChangePassword", errCode)
+}
+
+// Delete deletes the keychain, removing it from the keychain search list.
+// If Security.framework can't delete it, the keychain file is removed.
+func (kc Keychain) Delete() error {
+	if kc.path == "" {
+		return fmt.Errorf("refusing to delete the default keychain")
+	}
+	ref, err := kc.ref()
+	if err == nil {
+		errCode := C.SecKeychainDelete(ref)
+		Release(C.CFTypeRef(ref))
+		if checkError(errCode) == nil {
+			return nil
+		}
+	}
+	return os.Remove(kc.path)
+}
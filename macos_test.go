@@ -4,7 +4,16 @@
 package keychain
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestUpdateItem(t *testing.T) {
@@ -45,6 +54,30 @@ func TestUpdateItem(t *testing.T) {
 	}
 }
 
+func TestUpdateGenericPassword(t *testing.T) {
+	item := NewGenericPassword("TestUpdateGenericPassword", "test", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UpdateGenericPassword("TestUpdateGenericPassword", "test", []byte("toomanysecrets2")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := GetGenericPassword("TestUpdateGenericPassword", "test", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "toomanysecrets2" {
+		t.Fatal("updated generic password does not match")
+	}
+
+	err = UpdateGenericPassword("TestUpdateGenericPassword", "missing", []byte("toomanysecrets2"))
+	if !errors.Is(err, ErrorItemNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
 func TestGenericPassword(t *testing.T) {
 	service, account, label, accessGroup, password := "TestGenericPasswordRef", "test", "", "", "toomanysecrets"
 
@@ -69,6 +102,30 @@ func TestGenericPassword(t *testing.T) {
 	}
 }
 
+func TestItemExists(t *testing.T) {
+	item := NewGenericPassword("TestItemExists", "test", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err := ItemExists(NewGenericPassword("TestItemExists", "test", "", nil, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected item to exist")
+	}
+
+	exists, err = ItemExists(NewGenericPassword("TestItemExists", "missing", "", nil, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("expected item not to exist")
+	}
+}
+
 func TestInternetPassword(t *testing.T) {
 	item := NewItem()
 	item.SetSecClass(SecClassInternetPassword)
@@ -127,3 +184,1348 @@ func TestInternetPassword(t *testing.T) {
 		t.Errorf("expected comment 'this is the comment' but got %q", r.Comment)
 	}
 }
+
+func TestQuerySecClasses(t *testing.T) {
+	for _, secClass := range secClasses {
+		if _, ok := secClassTypeRef[secClass]; !ok {
+			t.Fatalf("missing kSecClass for %d", secClass)
+		}
+		query := NewItem()
+		query.SetSecClass(secClass)
+		query.SetMatchLimit(MatchLimitAll)
+		query.SetReturnAttributes(true)
+		if _, err := QueryItem(query); err != nil {
+			t.Errorf("query for class %d failed: %v", secClass, err)
+		}
+	}
+}
+
+func TestMatchItemList(t *testing.T) {
+	item := NewGenericPassword("TestMatchItemList", "test", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestMatchItemList")
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnAttributes(true)
+	query.SetReturnPersistentRef(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || len(results[0].PersistentRef) == 0 {
+		t.Fatalf("expected persistent ref, got %v", results)
+	}
+
+	listQuery := NewItem()
+	listQuery.SetSecClass(SecClassGenericPassword)
+	listQuery.SetMatchItemList([][]byte{results[0].PersistentRef})
+	listQuery.SetMatchLimit(MatchLimitAll)
+	listQuery.SetReturnAttributes(true)
+	results, err = QueryItem(listQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Service != "TestMatchItemList" {
+		t.Fatalf("expected item from list, got %v", results)
+	}
+}
+
+func TestGetItemByPersistentRef(t *testing.T) {
+	item := NewGenericPassword("TestGetItemByPersistentRef", "test", "label", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestGetItemByPersistentRef")
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnAttributes(true)
+	query.SetReturnPersistentRef(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+
+	result, err := GetItemByPersistentRef(results[0].PersistentRef, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result == nil {
+		t.Fatal("expected item for persistent ref")
+	}
+	if result.Label != "label" || string(result.Data) != "toomanysecrets" {
+		t.Fatalf("unexpected result %v", result)
+	}
+}
+
+func TestQueryRawAttributes(t *testing.T) {
+	item := NewGenericPassword("TestQueryRawAttributes", "test", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestQueryRawAttributes")
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnAttributes(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	if results[0].RawAttributes[ServiceKey] != "TestQueryRawAttributes" {
+		t.Errorf("expected service in raw attributes, got %v", results[0].RawAttributes)
+	}
+	if _, ok := results[0].RawAttributes[CreationDateKey].(time.Time); !ok {
+		t.Errorf("expected creation date in raw attributes, got %v", results[0].RawAttributes)
+	}
+}
+
+func TestQueryDateRange(t *testing.T) {
+	item := NewGenericPassword("TestQueryDateRange", "test", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestQueryDateRange")
+	query.SetCreatedAfter(time.Now().Add(-time.Hour))
+	if _, err := QueryItem(query); err == nil {
+		t.Fatal("expected error for date filter without MatchLimitAll")
+	}
+	if err := DeleteItem(query); err == nil {
+		t.Fatal("expected error for DeleteItem with date filter")
+	}
+
+	query.SetMatchLimit(MatchLimitAll)
+	query.SetReturnAttributes(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+
+	query.SetModifiedBefore(time.Now().Add(-time.Hour))
+	results, err = QueryItem(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected no results, got %d", len(results))
+	}
+}
+
+func TestGetInternetPassword(t *testing.T) {
+	item := NewInternetPassword("TestGetInternetPassword.example.com", "test", ProtocolHTTPS, 8443, "/login", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := GetInternetPassword("TestGetInternetPassword.example.com", "test", ProtocolHTTPS, 8443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "toomanysecrets" {
+		t.Fatalf("expected password, got %q", data)
+	}
+
+	data, err = GetInternetPassword("TestGetInternetPassword.example.com", "test", ProtocolHTTP, 8443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != nil {
+		t.Fatal("Shouldn't have password")
+	}
+}
+
+func TestUpsertItem(t *testing.T) {
+	item := NewGenericPassword("TestUpsertItem", "test", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := UpsertItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	item.SetData([]byte("toomanysecrets2"))
+	if err := UpsertItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := GetGenericPassword("TestUpsertItem", "test", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "toomanysecrets2" {
+		t.Fatalf("expected updated password, got %q", data)
+	}
+}
+
+func TestUpsertItemDataProtectionKeychain(t *testing.T) {
+	item := NewGenericPassword("TestUpsertItemDataProtectionKeychain", "test", "", []byte("toomanysecrets"), "")
+	item.SetUseDataProtectionKeychain(true)
+	defer func() { _ = DeleteItem(item) }()
+	err := UpsertItem(item)
+	if errors.Is(err, ErrorMissingEntitlement) {
+		t.Skip("data protection keychain requires a signed binary")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item.SetData([]byte("toomanysecrets2"))
+	if err := UpsertItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewGenericPassword("TestUpsertItemDataProtectionKeychain", "test", "", nil, "")
+	query.SetUseDataProtectionKeychain(true)
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnData(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || string(results[0].Data) != "toomanysecrets2" {
+		t.Fatalf("expected updated password, got %v", results)
+	}
+}
+
+func TestGetGenericPasswordWithAttributes(t *testing.T) {
+	item := NewGenericPassword("TestGetGenericPasswordWithAttributes", "test", "label", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := GetGenericPasswordWithAttributes("TestGetGenericPasswordWithAttributes", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result == nil {
+		t.Fatal("expected result")
+	}
+	if string(result.Data) != "toomanysecrets" || result.Label != "label" || result.CreationDate.IsZero() {
+		t.Fatalf("unexpected result %v", result)
+	}
+}
+
+func TestListItems(t *testing.T) {
+	item := NewGenericPassword("TestListItems", "test", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := ListItems(0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, r := range results {
+		if r.Service == "TestListItems" {
+			found = true
+			if r.Data != nil {
+				t.Error("Shouldn't have data")
+			}
+		}
+	}
+	if !found {
+		t.Fatal("expected item in list")
+	}
+}
+
+func TestQueryOptions(t *testing.T) {
+	item1 := NewGenericPassword("TestQueryOptions", "test1", "", []byte("toomanysecrets1"), "")
+	item2 := NewGenericPassword("TestQueryOptions", "test2", "", []byte("toomanysecrets2"), "")
+	defer func() { _ = DeleteItem(item1) }()
+	defer func() { _ = DeleteItem(item2) }()
+	if err := AddItem(item1); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddItem(item2); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Query("TestQueryOptions", WithReturnData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if string(r.Data) != "toomanysecrets"+r.Account[len("test"):] {
+			t.Errorf("unexpected data %q for %s", r.Data, r.Account)
+		}
+	}
+
+	results, err = Query("TestQueryOptions", WithAccount("test2"), WithLimit(1), WithReturnData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || string(results[0].Data) != "toomanysecrets2" {
+		t.Fatalf("unexpected results %v", results)
+	}
+}
+
+func TestGetItemAccess(t *testing.T) {
+	item := NewGenericPassword("TestGetItemAccess", "test", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestGetItemAccess")
+	access, err := GetItemAccess(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access == nil {
+		t.Fatal("expected access")
+	}
+	if !access.AllApplications && len(access.TrustedApplications) == 0 {
+		t.Fatal("expected the creating application to be trusted")
+	}
+}
+
+func TestDefaultKeychainStatus(t *testing.T) {
+	status, err := OpenKeychain("").Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Readable {
+		t.Fatal("expected default keychain to be readable")
+	}
+}
+
+func TestNewKeychain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TestNewKeychain.keychain")
+	kc, err := NewKeychain(path, KeychainOptions{Password: "keychainpassword", LockInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = kc.Delete() }()
+
+	status, err := kc.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Unlocked || !status.Readable || !status.Writable {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	if err := kc.ChangePassword("keychainpassword", "newkeychainpassword"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := kc.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected keychain file to be deleted, got %v", err)
+	}
+}
+
+func TestNewKeychainPartitionIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TestNewKeychainPartitionIDs.keychain")
+	access := &Access{
+		Label:        "TestNewKeychainPartitionIDs",
+		PartitionIDs: []string{"apple-tool:", "apple:", "teamid:ABCDE12345"},
+	}
+	kc, err := NewKeychain(path, KeychainOptions{Password: "keychainpassword", Access: access})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kc.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetAccessPartitionIDs(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := NewGenericPassword("TestSetAccessPartitionIDs", "test", "", []byte("toomanysecrets"), "")
+	item.SetAccess(&Access{
+		Label:               "TestSetAccessPartitionIDs",
+		TrustedApplications: []string{executable},
+		PartitionIDs:        []string{"teamid:ABCDE12345"},
+	})
+	defer func() { _ = DeleteItem(NewGenericPassword("TestSetAccessPartitionIDs", "test", "", nil, "")) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestSetAccessPartitionIDs")
+	access, err := GetItemAccess(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access == nil {
+		t.Fatal("expected access")
+	}
+	found := false
+	for _, id := range access.PartitionIDs {
+		found = found || id == "teamid:ABCDE12345"
+	}
+	if !found {
+		t.Fatalf("expected partition ID to be read back, got %v", access.PartitionIDs)
+	}
+	if len(access.TrustedApplications) == 0 {
+		t.Fatal("expected trusted application to be read back")
+	}
+}
+
+func TestGetTokenIdentities(t *testing.T) {
+	// There may be no tokens attached, but the query must succeed.
+	results, err := GetTokenIdentities("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.TokenID == "" {
+			t.Errorf("expected token ID for %+v", r)
+		}
+	}
+}
+
+func TestMigrateAccessible(t *testing.T) {
+	item := NewGenericPassword("TestMigrateAccessible", "test", "label", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestMigrateAccessible")
+	migrated, err := MigrateAccessible(query, AccessibleWhenUnlocked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 1 {
+		t.Fatalf("expected 1 migrated item, got %d", migrated)
+	}
+
+	result, err := GetGenericPasswordWithAttributes("TestMigrateAccessible", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result == nil || string(result.Data) != "toomanysecrets" || result.Label != "label" {
+		t.Fatalf("unexpected result after migration: %+v", result)
+	}
+}
+
+func TestMigrateAccessibleDataProtectionKeychain(t *testing.T) {
+	item := NewGenericPassword("TestMigrateAccessibleDataProtectionKeychain", "test", "", []byte("toomanysecrets"), "")
+	item.SetUseDataProtectionKeychain(true)
+	defer func() { _ = DeleteItem(item) }()
+	err := AddItem(item)
+	if errors.Is(err, ErrorMissingEntitlement) {
+		t.Skip("data protection keychain requires a signed binary")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := NewGenericPassword("TestMigrateAccessibleDataProtectionKeychain", "protected", "", []byte("toomanysecrets"), "")
+	protected.SetUseDataProtectionKeychain(true)
+	protected.SetAccessControl(AccessibleWhenUnlocked, 0)
+	defer func() { _ = DeleteItem(protected) }()
+	if err := AddItem(protected); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestMigrateAccessibleDataProtectionKeychain")
+	query.SetUseDataProtectionKeychain(true)
+	migrated, err := MigrateAccessible(query, AccessibleAfterFirstUnlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 1 {
+		t.Fatalf("expected 1 migrated item, got %d", migrated)
+	}
+
+	query.SetAccount("test")
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnAttributes(true)
+	query.SetReturnData(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Accessible != AccessibleAfterFirstUnlock || string(results[0].Data) != "toomanysecrets" {
+		t.Fatalf("unexpected result after migration: %+v", results)
+	}
+}
+
+func TestParseAccessControlConstraints(t *testing.T) {
+	tests := []struct {
+		constraints  string
+		flags        AccessControlFlags
+		unrecognized bool
+	}{
+		{";od(true);odel(true);oe(true)", 0, false},
+		{";od(cpo(DeviceOwnerAuthentication));odel(true);oe(true)", AccessControlUserPresence, false},
+		{";od(cup(true));odel(true);oe(true)", AccessControlDevicePasscode, false},
+		{";od(cbio(pbioc(<01>);pbioh(<02>)));odel(true);oe(true)", AccessControlBiometryCurrentSet, false},
+		{";od(cbio(pbioh(<02>)));odel(true);oe(true)", AccessControlBiometryAny, false},
+		{";od(cor(cbio(pbioh(<02>));cup(true)));odel(true);oe(true)", 0, true},
+		{";od(cpo(DeviceOwnerAuthentication);prp(true));odel(true);oe(true)", 0, true},
+		{";osgn(cpo(DeviceOwnerAuthentication));odel(true)", 0, true},
+		{";od(", 0, true},
+	}
+	for _, test := range tests {
+		flags, unrecognized := parseAccessControlConstraints(test.constraints)
+		if flags != test.flags || unrecognized != test.unrecognized {
+			t.Errorf("%q: got %v, %v; expected %v, %v", test.constraints, flags, unrecognized, test.flags, test.unrecognized)
+		}
+	}
+}
+
+func TestAccessControlReadback(t *testing.T) {
+	item := NewGenericPassword("TestAccessControlReadback", "test", "", []byte("toomanysecrets"), "")
+	item.SetUseDataProtectionKeychain(true)
+	item.SetAccessControl(AccessibleWhenUnlocked, AccessControlUserPresence)
+	defer func() { _ = DeleteItem(item) }()
+	err := AddItem(item)
+	if errors.Is(err, ErrorMissingEntitlement) {
+		t.Skip("data protection keychain requires a signed binary")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Querying attributes only doesn't require user presence
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestAccessControlReadback")
+	query.SetAccount("test")
+	query.SetUseDataProtectionKeychain(true)
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnAttributes(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].AccessControl == nil {
+		t.Fatalf("expected an access control, got %+v", results)
+	}
+	ac := results[0].AccessControl
+	if ac.Accessible != AccessibleWhenUnlocked || ac.Flags != AccessControlUserPresence || ac.Unrecognized {
+		t.Fatalf("unexpected access control: %+v", ac)
+	}
+}
+
+func TestErrorPredicates(t *testing.T) {
+	if !IsNotFound(ErrorItemNotFound) || !IsNotFound(fmt.Errorf("query: %w", ErrorItemNotFound)) {
+		t.Fatal("expected IsNotFound")
+	}
+	if IsNotFound(ErrorDuplicateItem) || IsNotFound(nil) {
+		t.Fatal("unexpected IsNotFound")
+	}
+	if !IsAuthRequired(ErrorInteractionNotAllowed) {
+		t.Fatal("expected IsAuthRequired")
+	}
+	if !IsPermissionDenied(ErrorMissingEntitlement) {
+		t.Fatal("expected IsPermissionDenied")
+	}
+}
+
+func TestOpError(t *testing.T) {
+	_, err := OpenKeychain(filepath.Join(t.TempDir(), "missing.keychain")).Status()
+	if err == nil {
+		t.Fatal("expected error for missing keychain")
+	}
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op == "" {
+		t.Fatalf("expected OpError, got %v", err)
+	}
+	if !errors.Is(err, ErrorNoSuchKeychain) {
+		t.Fatalf("expected ErrorNoSuchKeychain, got %v", err)
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	// Test binaries usually aren't signed with entitlements, so only check
+	// that findings are well formed.
+	for _, f := range Diagnose() {
+		if f.Check == "" || f.Err == nil || f.Advice == "" {
+			t.Errorf("incomplete finding %+v", f)
+		}
+	}
+}
+
+func TestDebugQuery(t *testing.T) {
+	queries := make(map[string]map[string]string)
+	DebugQuery = func(op string, query map[string]string) {
+		queries[op] = query
+	}
+	defer func() { DebugQuery = nil }()
+
+	item := NewGenericPassword("TestDebugQuery", "test", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetGenericPassword("TestDebugQuery", "test", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := queries["SecItemAdd"][DataKey]; got != "<redacted 14 bytes>" {
+		t.Errorf("expected redacted data, got %q", got)
+	}
+	if got := queries["SecItemCopyMatching"][ServiceKey]; got != `"TestDebugQuery"` {
+		t.Errorf("unexpected service %q", got)
+	}
+}
+
+func TestLeakDetection(t *testing.T) {
+	EnableLeakDetection()
+	defer DisableLeakDetection()
+
+	item := NewGenericPassword("TestLeakDetection", "test", "", []byte("toomanysecrets"), "")
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetGenericPassword("TestLeakDetection", "test", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteItem(item); err != nil {
+		t.Fatal(err)
+	}
+	if objects := OutstandingCFObjects(); len(objects) != 0 {
+		t.Fatalf("unreleased CF objects: %v", objects)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	calls, unlocks := 0, 0
+	opts := RetryOptions{
+		Unlock:  func() error { unlocks++; return nil },
+		Backoff: time.Millisecond,
+	}
+	err := WithRetry(opts, func() error {
+		calls++
+		if calls < 3 {
+			return ErrorInteractionNotAllowed
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || unlocks != 2 {
+		t.Fatalf("expected 3 calls and 2 unlocks, got %d and %d", calls, unlocks)
+	}
+
+	calls = 0
+	err = WithRetry(opts, func() error {
+		calls++
+		return ErrorItemNotFound
+	})
+	if err != ErrorItemNotFound || calls != 1 {
+		t.Fatalf("expected no retry for ErrorItemNotFound, got %v after %d calls", err, calls)
+	}
+}
+
+func TestConvertCFValue(t *testing.T) {
+	item := NewGenericPassword("TestConvertCFValue", "test", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestConvertCFValue")
+	query.SetMatchLimit(MatchLimitAll)
+	query.SetReturnAttributes(true)
+	ref, err := QueryItemRef(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Release(ref)
+
+	results, ok := ConvertCFValue(ref).([]interface{})
+	if !ok || len(results) != 1 {
+		t.Fatalf("expected one result, got %#v", results)
+	}
+	attrs, ok := results[0].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected map[string]interface{}, got %T", results[0])
+	}
+	if attrs[ServiceKey] != "TestConvertCFValue" || attrs[AccountKey] != "test" {
+		t.Fatalf("unexpected attributes %v", attrs)
+	}
+}
+
+type testLabel string
+
+func (l testLabel) Convert() (CFTypeRef, error) {
+	ref, err := StringToCFString(string(l))
+	return CFTypeRef(ref), err
+}
+
+func TestSetConvertable(t *testing.T) {
+	item := NewGenericPassword("TestSetConvertable", "test", "", []byte("toomanysecrets"), "")
+	item.SetConvertable(LabelKey, testLabel("custom label"))
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := GetGenericPasswordWithAttributes("TestSetConvertable", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result == nil || result.Label != "custom label" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestBorrowItemData(t *testing.T) {
+	data := bytes.Repeat([]byte("toomanysecrets"), 100000)
+	item := NewGenericPassword("TestBorrowItemData", "test", "", data, "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestBorrowItemData")
+	err := BorrowItemData(query, func(b []byte) error {
+		if !bytes.Equal(b, data) {
+			t.Error("borrowed data doesn't match")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query.SetService("TestBorrowItemDataMissing")
+	err = BorrowItemData(query, func([]byte) error { return nil })
+	if err != ErrorItemNotFound {
+		t.Fatalf("expected ErrorItemNotFound, got %v", err)
+	}
+}
+
+func TestAddItems(t *testing.T) {
+	items := []Item{
+		NewGenericPassword("TestAddItems", "test1", "", []byte("toomanysecrets1"), ""),
+		NewGenericPassword("TestAddItems", "test2", "", []byte("toomanysecrets2"), ""),
+	}
+	defer func() {
+		for _, item := range items {
+			_ = DeleteItem(item)
+		}
+	}()
+	if errs := AddItems(items); errs != nil {
+		t.Fatal(errs)
+	}
+
+	errs := AddItems(items[:1])
+	if len(errs) != 1 || errs[0] != ErrorDuplicateItem {
+		t.Fatalf("expected duplicate item error, got %v", errs)
+	}
+
+	accounts, err := GetGenericPasswordAccounts("TestAddItems")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %v", accounts)
+	}
+}
+
+func BenchmarkQueryItemAttributes(b *testing.B) {
+	const n = 200
+	for i := 0; i < n; i++ {
+		item := NewGenericPassword("BenchmarkQueryItemAttributes", fmt.Sprintf("account%d", i), "label", []byte("toomanysecrets"), "")
+		if err := AddItem(item); err != nil {
+			b.Fatal(err)
+		}
+	}
+	defer func() {
+		for i := 0; i < n; i++ {
+			_ = DeleteGenericPasswordItem("BenchmarkQueryItemAttributes", fmt.Sprintf("account%d", i))
+		}
+	}()
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("BenchmarkQueryItemAttributes")
+	query.SetMatchLimit(MatchLimitAll)
+	query.SetReturnAttributes(true)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		results, err := QueryItem(query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(results) != n {
+			b.Fatalf("expected %d results, got %d", n, len(results))
+		}
+	}
+}
+
+func BenchmarkConvertMapToCFDictionary(b *testing.B) {
+	item := NewGenericPassword("BenchmarkConvertMapToCFDictionary", "account", "label", []byte("toomanysecrets"), "")
+	item.SetMatchLimit(MatchLimitAll)
+	item.SetReturnAttributes(true)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cfDict, err := ConvertMapToCFDictionary(item.attr)
+		if err != nil {
+			b.Fatal(err)
+		}
+		releaseCFDictionary(cfDict)
+	}
+}
+
+func TestConcurrentQueries(t *testing.T) {
+	item := NewGenericPassword("TestConcurrentQueries", "test", "", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestConcurrentQueries")
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnAttributes(true)
+	query.SetReturnData(true)
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			results, err := QueryItem(query)
+			if err == nil && (len(results) != 1 || string(results[0].Data) != "toomanysecrets") {
+				err = fmt.Errorf("unexpected results %+v", results)
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestQueryResultJSON(t *testing.T) {
+	item := NewGenericPassword("TestQueryResultJSON", "test", "label", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+	result, err := GetGenericPasswordWithAttributes("TestQueryResultJSON", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("toomanysecrets")) || bytes.Contains(b, []byte(base64.StdEncoding.EncodeToString([]byte("toomanysecrets")))) {
+		t.Fatalf("data not redacted: %s", b)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["Service"] != "TestQueryResultJSON" || decoded["DataRedacted"] != true {
+		t.Fatalf("unexpected JSON %s", b)
+	}
+
+	b, err = result.MarshalJSONWithData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte(base64.StdEncoding.EncodeToString([]byte("toomanysecrets")))) {
+		t.Fatalf("expected data: %s", b)
+	}
+
+	b, err = json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("toomanysecrets")) {
+		t.Fatalf("item data not redacted: %s", b)
+	}
+}
+
+func TestStringRedactsData(t *testing.T) {
+	item := NewGenericPassword("TestStringRedactsData", "test", "label", []byte("toomanysecrets"), "")
+	s := fmt.Sprintf("%v", item)
+	if strings.Contains(s, "toomanysecrets") || !strings.Contains(s, `service="TestStringRedactsData"`) || !strings.Contains(s, "class=GenericPassword") {
+		t.Fatalf("unexpected item string %s", s)
+	}
+
+	result := QueryResult{Service: "TestStringRedactsData", Account: "test", Data: []byte("toomanysecrets")}
+	s = fmt.Sprintf("%v", result)
+	if strings.Contains(s, "toomanysecrets") || !strings.Contains(s, "<redacted 14 bytes>") {
+		t.Fatalf("unexpected result string %s", s)
+	}
+	if s := fmt.Sprintf("%v", []QueryResult{result}); strings.Contains(s, "toomanysecrets") {
+		t.Fatalf("unexpected results string %s", s)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := NewGenericPassword("TestValidate", "test", "", []byte("toomanysecrets"), "")
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	noClass := NewItem()
+	noClass.SetService("TestValidate")
+
+	noService := NewGenericPassword("", "test", "", []byte("toomanysecrets"), "")
+
+	noServer := NewItem()
+	noServer.SetSecClass(SecClassInternetPassword)
+	noServer.SetAccount("test")
+
+	bothAccess := valid.clone()
+	bothAccess.SetAccessControl(AccessibleWhenUnlocked, AccessControlUserPresence)
+	bothAccess.SetAccessible(AccessibleWhenUnlocked)
+
+	returnDataAll := valid.clone()
+	returnDataAll.SetReturnData(true)
+	returnDataAll.SetMatchLimit(MatchLimitAll)
+
+	for name, item := range map[string]Item{
+		"no class":      noClass,
+		"no service":    noService,
+		"no server":     noServer,
+		"both access":   bothAccess,
+		"data with all": returnDataAll,
+	} {
+		if err := item.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := AddItem(noService); err == nil || err.Error() != "GenericPassword items require a service" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestQueryGenericPasswords(t *testing.T) {
+	item := NewGenericPassword("TestQueryGenericPasswords", "test", "label", []byte("toomanysecrets"), "")
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetService("TestQueryGenericPasswords")
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnAttributes(true)
+	query.SetReturnData(true)
+	results, err := QueryGenericPasswords(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	r := results[0]
+	if r.Service != "TestQueryGenericPasswords" || r.Account != "test" || r.Label != "label" || string(r.Data) != "toomanysecrets" {
+		t.Fatalf("unexpected result %+v", r)
+	}
+
+	query = NewItem()
+	query.SetServer("TestQueryGenericPasswords")
+	query.SetMatchLimit(MatchLimitAll)
+	query.SetReturnAttributes(true)
+	internet, err := QueryInternetPasswords(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(internet) != 0 {
+		t.Fatalf("expected no internet passwords, got %d", len(internet))
+	}
+}
+
+func TestQueryItems(t *testing.T) {
+	var items []Item
+	for i := 0; i < 3; i++ {
+		item := NewGenericPassword("TestQueryItems", fmt.Sprintf("account%d", i), "", []byte(fmt.Sprintf("toomanysecrets%d", i)), "")
+		items = append(items, item)
+	}
+	defer func() {
+		for _, item := range items {
+			_ = DeleteItem(item)
+		}
+	}()
+	if errs := AddItems(items); errs != nil {
+		t.Fatal(errs)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestQueryItems")
+	it, err := QueryItems(query, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it.Len() != 3 {
+		t.Fatalf("expected 3 items, got %d", it.Len())
+	}
+	if r := it.Result(); r.Account != "" {
+		t.Fatalf("expected empty result before Next, got %+v", r)
+	}
+	// Deleted items are skipped.
+	if err := DeleteItem(items[0]); err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]string{}
+	for it.Next() {
+		r := it.Result()
+		if len(r.PersistentRef) == 0 {
+			t.Fatal("expected persistent ref")
+		}
+		seen[r.Account] = string(r.Data)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"account1": "toomanysecrets1", "account2": "toomanysecrets2"}
+	if fmt.Sprint(seen) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, seen)
+	}
+	if r := it.Result(); r.Account != "" {
+		t.Fatalf("expected empty result after iteration, got %+v", r)
+	}
+}
+
+func TestQueryItemsDataProtectionKeychain(t *testing.T) {
+	item := NewGenericPassword("TestQueryItemsDataProtectionKeychain", "test", "", []byte("toomanysecrets"), "")
+	item.SetUseDataProtectionKeychain(true)
+	defer func() { _ = DeleteItem(item) }()
+	err := AddItem(item)
+	if errors.Is(err, ErrorMissingEntitlement) {
+		t.Skip("data protection keychain requires a signed binary")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewItem()
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService("TestQueryItemsDataProtectionKeychain")
+	query.SetUseDataProtectionKeychain(true)
+	it, err := QueryItems(query, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for it.Next() {
+		if r := it.Result(); string(r.Data) != "toomanysecrets" {
+			t.Fatalf("unexpected result %+v", r)
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 item, got %d", n)
+	}
+}
+
+func TestStoreJSON(t *testing.T) {
+	type credentials struct {
+		Token   string
+		Expires time.Time
+	}
+	item := NewGenericPassword("TestStoreJSON", "test", "", nil, "")
+	defer func() { _ = DeleteItem(item) }()
+
+	stored := credentials{Token: "toomanysecrets", Expires: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := StoreJSON(item, stored); err != nil {
+		t.Fatal(err)
+	}
+	stored.Token = "toomanysecrets2"
+	if err := StoreJSON(item, stored); err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded credentials
+	if err := LoadJSON(item, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Token != stored.Token || !loaded.Expires.Equal(stored.Expires) {
+		t.Fatalf("expected %+v, got %+v", stored, loaded)
+	}
+}
+
+func TestStoreChunked(t *testing.T) {
+	item := NewGenericPassword("TestStoreChunked", "test", "", nil, "")
+	defer func() { _ = DeleteChunked(item) }()
+
+	data := bytes.Repeat([]byte("toomanysecrets"), 100)
+	if err := StoreChunked(item, data, 512); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadChunked(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, loaded) {
+		t.Fatal("chunked data mismatch")
+	}
+
+	// Storing less data removes the extra chunks.
+	if err := StoreChunked(item, data[:100], 512); err != nil {
+		t.Fatal(err)
+	}
+	chunk := NewGenericPassword("TestStoreChunked", chunkAccount("test", 1), "", nil, "")
+	if exists, err := ItemExists(chunk); err != nil || exists {
+		t.Fatalf("expected chunk to be deleted: %v %v", exists, err)
+	}
+	loaded, err = LoadChunked(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[:100], loaded) {
+		t.Fatal("chunked data mismatch")
+	}
+
+	if err := DeleteChunked(item); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadChunked(item); !errors.Is(err, ErrorItemNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestSetCompressedData(t *testing.T) {
+	data := bytes.Repeat([]byte("toomanysecrets"), 1000)
+	item := NewGenericPassword("TestSetCompressedData", "test", "", nil, "")
+	if err := item.SetCompressedData(data, 1024); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = DeleteItem(item) }()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewGenericPassword("TestSetCompressedData", "test", "", nil, "")
+	if err := BorrowItemData(query, func(stored []byte) error {
+		if len(stored) >= len(data) {
+			return fmt.Errorf("expected compressed data, got %d bytes", len(stored))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := GetGenericPassword("TestSetCompressedData", "test", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, loaded) {
+		t.Fatal("decompressed data mismatch")
+	}
+}
+
+func TestCompressedDataMarker(t *testing.T) {
+	// Data that looks compressed is returned as stored without the marker.
+	compressed, _, err := CompressData(bytes.Repeat([]byte("toomanysecrets"), 1000), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := NewGenericPassword("TestCompressedDataMarker", "plain", "", compressed, "")
+	defer func() { _ = DeleteItem(plain) }()
+	if err := AddItem(plain); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := GetGenericPassword("TestCompressedDataMarker", "plain", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(compressed, loaded) {
+		t.Fatal("expected data as stored")
+	}
+
+	// Marked data that can't be decompressed is reported on the result.
+	corrupt := NewGenericPassword("TestCompressedDataMarker", "corrupt", "", []byte("toomanysecrets"), "")
+	corrupt.SetType(CompressedDataType)
+	defer func() { _ = DeleteItem(corrupt) }()
+	if err := AddItem(corrupt); err != nil {
+		t.Fatal(err)
+	}
+	query := NewGenericPassword("TestCompressedDataMarker", "corrupt", "", nil, "")
+	query.SetMatchLimit(MatchLimitOne)
+	query.SetReturnData(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].DataErr == nil || string(results[0].Data) != "toomanysecrets" {
+		t.Fatalf("expected decompression error on the result, got %+v", results)
+	}
+	if _, err := GetGenericPassword("TestCompressedDataMarker", "corrupt", "", ""); err == nil {
+		t.Fatal("expected decompression error")
+	}
+}
+
+func TestGroupDuplicates(t *testing.T) {
+	now := time.Now()
+	fileKeychain := []QueryResult{
+		{Account: "a", Label: "old", Data: []byte("secret"), ModificationDate: now.Add(-time.Hour), PersistentRef: []byte("1")},
+		{Account: "a", Label: "other", Data: []byte("different"), ModificationDate: now, PersistentRef: []byte("3")},
+		{Account: "b", Data: []byte("secret"), ModificationDate: now, PersistentRef: []byte("4")},
+		{Account: "c", Data: []byte("secret"), ModificationDate: now, PersistentRef: []byte("5")},
+	}
+	dataProtectionKeychain := []QueryResult{
+		{Account: "a", Label: "new", AccessGroup: "group", Data: []byte("secret"), ModificationDate: now, PersistentRef: []byte("2")},
+		// Items in different access groups of a keychain are ambiguous
+		{Account: "c", AccessGroup: "group", Data: []byte("secret"), ModificationDate: now, PersistentRef: []byte("6")},
+		{Account: "c", AccessGroup: "other", Data: []byte("secret"), ModificationDate: now, PersistentRef: []byte("7")},
+	}
+	groups := groupDuplicates([][]QueryResult{fileKeychain, dataProtectionKeychain})
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(groups))
+	}
+	if groups[0].Keep.Label != "new" || len(groups[0].Duplicates) != 1 || groups[0].Duplicates[0].Label != "old" {
+		t.Fatalf("unexpected group %+v", groups[0])
+	}
+	if groups[0].Keep.Data != nil || groups[0].Duplicates[0].Data != nil {
+		t.Fatal("expected data to be removed")
+	}
+	if !bytes.Equal(fileKeychain[0].Data, make([]byte, len("secret"))) {
+		t.Fatal("expected data to be wiped")
+	}
+
+	// Matching items in a single keychain aren't duplicates
+	if groups := groupDuplicates([][]QueryResult{dataProtectionKeychain}); len(groups) != 0 {
+		t.Fatalf("expected no groups, got %+v", groups)
+	}
+}
+
+func TestRemoveDuplicatesAcrossKeychains(t *testing.T) {
+	fileItem := NewGenericPassword("TestRemoveDuplicatesAcrossKeychains", "test", "old", []byte("toomanysecrets"), "")
+	dataProtectionItem := NewGenericPassword("TestRemoveDuplicatesAcrossKeychains", "test", "new", []byte("toomanysecrets"), "")
+	dataProtectionItem.SetUseDataProtectionKeychain(true)
+	defer func() {
+		_ = DeleteItem(fileItem)
+		_ = DeleteItem(dataProtectionItem)
+	}()
+	if err := AddItem(fileItem); err != nil {
+		t.Fatal(err)
+	}
+	err := AddItem(dataProtectionItem)
+	if errors.Is(err, ErrorMissingEntitlement) {
+		t.Skip("data protection keychain requires a signed binary")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := FindDuplicates("TestRemoveDuplicatesAcrossKeychains")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0].Duplicates) != 1 {
+		t.Fatalf("expected 1 group with 1 duplicate, got %+v", groups)
+	}
+	removed, err := RemoveDuplicates("TestRemoveDuplicatesAcrossKeychains")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || !bytes.Equal(removed[0].PersistentRef, groups[0].Duplicates[0].PersistentRef) {
+		t.Fatalf("expected the duplicate to be removed, got %+v", removed)
+	}
+
+	var remaining int
+	for _, useDataProtection := range []bool{false, true} {
+		query := NewItem()
+		query.SetSecClass(SecClassGenericPassword)
+		query.SetService("TestRemoveDuplicatesAcrossKeychains")
+		query.SetUseDataProtectionKeychain(useDataProtection)
+		query.SetMatchLimit(MatchLimitAll)
+		query.SetReturnAttributes(true)
+		results, err := QueryItem(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		remaining += len(results)
+	}
+	if remaining != 1 {
+		t.Fatalf("expected 1 remaining item, got %d", remaining)
+	}
+	if groups, err := FindDuplicates("TestRemoveDuplicatesAcrossKeychains"); err != nil || len(groups) != 0 {
+		t.Fatalf("expected no duplicates, got %+v, %v", groups, err)
+	}
+}
+
+func TestRenameService(t *testing.T) {
+	item := NewGenericPassword("TestRenameService", "test", "label", []byte("toomanysecrets"), "")
+	defer func() {
+		_ = DeleteItem(item)
+		_ = DeleteItem(NewGenericPassword("TestRenameServiceRenamed", "test", "", nil, ""))
+	}()
+	if err := AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+	before, err := GetGenericPasswordWithAttributes("TestRenameService", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renamed, err := RenameService("TestRenameService", "TestRenameServiceRenamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed != 1 {
+		t.Fatalf("expected 1 renamed item, got %d", renamed)
+	}
+	if old, err := GetGenericPassword("TestRenameService", "test", "", ""); err != nil || old != nil {
+		t.Fatalf("expected old item to be gone: %v", err)
+	}
+	after, err := GetGenericPasswordWithAttributes("TestRenameServiceRenamed", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after == nil || after.Label != "label" || !after.CreationDate.Equal(before.CreationDate) {
+		t.Fatalf("unexpected renamed item %+v", after)
+	}
+	data, err := GetGenericPassword("TestRenameServiceRenamed", "test", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "toomanysecrets" {
+		t.Fatalf("unexpected data %q", data)
+	}
+}
@@ -0,0 +1,109 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+import "fmt"
+
+// QueryOption configures a Query.
+type QueryOption func(*queryOptions)
+
+type queryOptions struct {
+	item       Item
+	limit      int
+	returnData bool
+}
+
+// WithAccount limits the query to the account.
+func WithAccount(account string) QueryOption {
+	return func(o *queryOptions) {
+		o.item.SetAccount(account)
+	}
+}
+
+// WithLabel limits the query to the label.
+func WithLabel(label string) QueryOption {
+	return func(o *queryOptions) {
+		o.item.SetLabel(label)
+	}
+}
+
+// WithAccessGroup limits the query to the access group.
+func WithAccessGroup(accessGroup string) QueryOption {
+	return func(o *queryOptions) {
+		o.item.SetAccessGroup(accessGroup)
+	}
+}
+
+// withKeychain limits the query to the keychain selected by selection.
+func withKeychain(selection Item) QueryOption {
+	return func(o *queryOptions) {
+		for key, v := range selection.keychainSelection().attr {
+			o.item.attr[key] = v
+		}
+	}
+}
+
+// WithLimit limits the number of results. The default is no limit.
+func WithLimit(limit int) QueryOption {
+	return func(o *queryOptions) {
+		o.limit = limit
+	}
+}
+
+// WithReturnData returns the password data of each result.
+func WithReturnData() QueryOption {
+	return func(o *queryOptions) {
+		o.returnData = true
+	}
+}
+
+// Query returns the attributes of the generic password items for service,
+// configured by opts. This is a convenience method.
+//
+// Unlike QueryItem, WithReturnData can be used with any limit: if more than
+// one result is requested, the data of each item is fetched separately.
+func Query(service string, opts ...QueryOption) ([]QueryResult, error) {
+	o := queryOptions{item: NewItem()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.limit < 0 {
+		return nil, fmt.Errorf("invalid limit %d", o.limit)
+	}
+	query := o.item
+	query.SetSecClass(SecClassGenericPassword)
+	query.SetService(service)
+	query.SetReturnAttributes(true)
+	switch o.limit {
+	case 0:
+		query.SetMatchLimit(MatchLimitAll)
+	case 1:
+		query.SetMatchLimit(MatchLimitOne)
+		query.SetReturnData(o.returnData)
+		return QueryItem(query)
+	default:
+		query.attr[MatchLimitKey] = int32(o.limit)
+	}
+	if !o.returnData {
+		return QueryItem(query)
+	}
+
+	// Data can only be returned for a single item per query.
+	query.SetReturnPersistentRef(true)
+	results, err := QueryItem(query)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range results {
+		withData, err := getItemByPersistentRef(query, r.PersistentRef, true)
+		if err != nil {
+			return nil, err
+		}
+		if withData != nil {
+			results[i].Data = withData.Data
+			results[i].DataErr = withData.DataErr
+		}
+	}
+	return results, nil
+}
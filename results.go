@@ -0,0 +1,220 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+import "time"
+
+// GenericPasswordResult has the attributes that apply to generic password
+// items.
+type GenericPasswordResult struct {
+	Service          string
+	Account          string
+	Label            string
+	Description      string
+	Comment          string
+	Generic          []byte
+	Data             []byte
+	AccessGroup      string
+	CreationDate     time.Time
+	ModificationDate time.Time
+	Creator          FourCharCode
+	Type             FourCharCode
+	Accessible       Accessible
+	Synchronizable   Synchronizable
+	AccessControl    *AccessControl
+	PersistentRef    []byte
+}
+
+// InternetPasswordResult has the attributes that apply to internet password
+// items.
+type InternetPasswordResult struct {
+	Server             string
+	Protocol           Protocol
+	AuthenticationType AuthenticationType
+	Port               int32
+	Path               string
+	Account            string
+	Label              string
+	Description        string
+	Comment            string
+	Data               []byte
+	AccessGroup        string
+	CreationDate       time.Time
+	ModificationDate   time.Time
+	Creator            FourCharCode
+	Type               FourCharCode
+	Accessible         Accessible
+	Synchronizable     Synchronizable
+	AccessControl      *AccessControl
+	PersistentRef      []byte
+}
+
+// CertificateResult has the attributes that apply to certificate items.
+type CertificateResult struct {
+	Label         string
+	Subject       []byte
+	Issuer        []byte
+	SerialNumber  []byte
+	SubjectKeyID  []byte
+	PublicKeyHash []byte
+	AccessGroup   string
+	Accessible    Accessible
+	PersistentRef []byte
+	// Certificate is set if SetReturnRef(true)
+	Certificate *CertificateRef
+}
+
+// KeyResult has the attributes that apply to key items.
+type KeyResult struct {
+	Label            string
+	ApplicationTag   []byte
+	ApplicationLabel []byte
+	IsPermanent      bool
+	KeySizeInBits    int
+	TokenID          string
+	AccessGroup      string
+	Accessible       Accessible
+	Synchronizable   Synchronizable
+	AccessControl    *AccessControl
+	PersistentRef    []byte
+}
+
+// AsGenericPassword returns the generic password attributes of the result.
+func (r QueryResult) AsGenericPassword() GenericPasswordResult {
+	return GenericPasswordResult{
+		Service:          r.Service,
+		Account:          r.Account,
+		Label:            r.Label,
+		Description:      r.Description,
+		Comment:          r.Comment,
+		Generic:          r.Generic,
+		Data:             r.Data,
+		AccessGroup:      r.AccessGroup,
+		CreationDate:     r.CreationDate,
+		ModificationDate: r.ModificationDate,
+		Creator:          r.Creator,
+		Type:             r.Type,
+		Accessible:       r.Accessible,
+		Synchronizable:   r.Synchronizable,
+		AccessControl:    r.AccessControl,
+		PersistentRef:    r.PersistentRef,
+	}
+}
+
+// AsInternetPassword returns the internet password attributes of the result.
+func (r QueryResult) AsInternetPassword() InternetPasswordResult {
+	return InternetPasswordResult{
+		Server:             r.Server,
+		Protocol:           r.Protocol,
+		AuthenticationType: r.AuthenticationType,
+		Port:               r.Port,
+		Path:               r.Path,
+		Account:            r.Account,
+		Label:              r.Label,
+		Description:        r.Description,
+		Comment:            r.Comment,
+		Data:               r.Data,
+		AccessGroup:        r.AccessGroup,
+		CreationDate:       r.CreationDate,
+		ModificationDate:   r.ModificationDate,
+		Creator:            r.Creator,
+		Type:               r.Type,
+		Accessible:         r.Accessible,
+		Synchronizable:     r.Synchronizable,
+		AccessControl:      r.AccessControl,
+		PersistentRef:      r.PersistentRef,
+	}
+}
+
+// AsCertificate returns the certificate attributes of the result.
+func (r QueryResult) AsCertificate() CertificateResult {
+	return CertificateResult{
+		Label:         r.Label,
+		Subject:       r.Subject,
+		Issuer:        r.Issuer,
+		SerialNumber:  r.SerialNumber,
+		SubjectKeyID:  r.SubjectKeyID,
+		PublicKeyHash: r.PublicKeyHash,
+		AccessGroup:   r.AccessGroup,
+		Accessible:    r.Accessible,
+		PersistentRef: r.PersistentRef,
+		Certificate:   r.Certificate,
+	}
+}
+
+// AsKey returns the key attributes of the result.
+func (r QueryResult) AsKey() KeyResult {
+	return KeyResult{
+		Label:            r.Label,
+		ApplicationTag:   r.ApplicationTag,
+		ApplicationLabel: r.ApplicationLabel,
+		IsPermanent:      r.IsPermanent,
+		KeySizeInBits:    r.KeySizeInBits,
+		TokenID:          r.TokenID,
+		AccessGroup:      r.AccessGroup,
+		Accessible:       r.Accessible,
+		Synchronizable:   r.Synchronizable,
+		AccessControl:    r.AccessControl,
+		PersistentRef:    r.PersistentRef,
+	}
+}
+
+// queryClass runs the query limited to the class.
+func queryClass(query Item, secClass SecClass) ([]QueryResult, error) {
+	q := query.clone()
+	q.SetSecClass(secClass)
+	return QueryItem(q)
+}
+
+// QueryGenericPasswords runs the query for generic password items.
+func QueryGenericPasswords(query Item) ([]GenericPasswordResult, error) {
+	results, err := queryClass(query, SecClassGenericPassword)
+	if err != nil {
+		return nil, err
+	}
+	typed := make([]GenericPasswordResult, 0, len(results))
+	for _, r := range results {
+		typed = append(typed, r.AsGenericPassword())
+	}
+	return typed, nil
+}
+
+// QueryInternetPasswords runs the query for internet password items.
+func QueryInternetPasswords(query Item) ([]InternetPasswordResult, error) {
+	results, err := queryClass(query, SecClassInternetPassword)
+	if err != nil {
+		return nil, err
+	}
+	typed := make([]InternetPasswordResult, 0, len(results))
+	for _, r := range results {
+		typed = append(typed, r.AsInternetPassword())
+	}
+	return typed, nil
+}
+
+// QueryCertificates runs the query for certificate items.
+func QueryCertificates(query Item) ([]CertificateResult, error) {
+	results, err := queryClass(query, SecClassCertificate)
+	if err != nil {
+		return nil, err
+	}
+	typed := make([]CertificateResult, 0, len(results))
+	for _, r := range results {
+		typed = append(typed, r.AsCertificate())
+	}
+	return typed, nil
+}
+
+// QueryKeys runs the query for key items.
+func QueryKeys(query Item) ([]KeyResult, error) {
+	results, err := queryClass(query, SecClassCryptoKey)
+	if err != nil {
+		return nil, err
+	}
+	typed := make([]KeyResult, 0, len(results))
+	for _, r := range results {
+		typed = append(typed, r.AsKey())
+	}
+	return typed, nil
+}
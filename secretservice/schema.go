@@ -0,0 +1,34 @@
+package secretservice
+
+// SchemaAttribute is the attribute libsecret uses to record an item's schema.
+const SchemaAttribute = "xdg:schema"
+
+// SchemaGeneric is the libsecret schema for generic passwords.
+const SchemaGeneric = "org.freedesktop.Secret.Generic"
+
+// SchemaNetworkPassword is the libsecret compatibility schema for network
+// passwords, with the attributes user, domain, object, protocol, port,
+// server and authtype.
+const SchemaNetworkPassword = "org.gnome.keyring.NetworkPassword"
+
+// SchemaNote is the libsecret compatibility schema for notes, which have no
+// attributes.
+const SchemaNote = "org.gnome.keyring.Note"
+
+// NewSchemaAttributes returns the attributes with the schema set, so items
+// created with them can be found by secret-tool and libsecret applications
+// using the schema.
+func NewSchemaAttributes(schema string, attributes map[string]string) Attributes {
+	schemaAttributes := make(Attributes, len(attributes)+1)
+	for k, v := range attributes {
+		schemaAttributes[k] = v
+	}
+	schemaAttributes[SchemaAttribute] = schema
+	return schemaAttributes
+}
+
+// Schema returns the libsecret schema of the attributes, or "" if none is
+// set.
+func (a Attributes) Schema() string {
+	return a[SchemaAttribute]
+}
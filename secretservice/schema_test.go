@@ -0,0 +1,16 @@
+package secretservice
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSchemaAttributes(t *testing.T) {
+	attributes := map[string]string{"user": "testuser"}
+	schemaAttributes := NewSchemaAttributes(SchemaNetworkPassword, attributes)
+	require.Equal(t, Attributes{"user": "testuser", "xdg:schema": "org.gnome.keyring.NetworkPassword"}, schemaAttributes)
+	require.Equal(t, SchemaNetworkPassword, schemaAttributes.Schema())
+	require.Equal(t, map[string]string{"user": "testuser"}, attributes)
+	require.Equal(t, "", Attributes(attributes).Schema())
+}
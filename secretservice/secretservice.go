@@ -2,6 +2,8 @@ package secretservice
 
 import (
 	"math/big"
+	"strings"
+	"sync"
 	"time"
 
 	dbus "github.com/keybase/dbus"
@@ -48,9 +50,24 @@ type PromptCompletedResult struct {
 
 // SecretService
 type SecretService struct {
+	// connect opens a new connection to the bus
+	connect func(...dbus.ConnOption) (*dbus.Conn, error)
+	// mu protects conn, signalCh, sessionOpenTimeout, autoReconnect, sessions
+	// and closed
+	mu                 sync.Mutex
 	conn               *dbus.Conn
 	signalCh           <-chan *dbus.Signal
 	sessionOpenTimeout time.Duration
+	autoReconnect      bool
+	// sessions are the sessions open on conn, which Close closes. They're
+	// lost with the connection.
+	sessions map[*Session]struct{}
+	closed   bool
+	// reconnectMu serializes reconnects
+	reconnectMu sync.Mutex
+	// managedMu protects managed, the session returned by Session
+	managedMu sync.Mutex
+	managed   *Session
 }
 
 // Session
@@ -65,31 +82,184 @@ type Session struct {
 // DefaultSessionOpenTimeout
 const DefaultSessionOpenTimeout = 10 * time.Second
 
-// NewService
+// NewService connects to the session bus.
 func NewService() (*SecretService, error) {
-	conn, err := dbus.ConnectSessionBus()
+	return newService(dbus.ConnectSessionBus)
+}
+
+// NewSystemService connects to the system bus, for a Secret Service running
+// there.
+func NewSystemService() (*SecretService, error) {
+	return newService(dbus.ConnectSystemBus)
+}
+
+// NewServiceWithAddress connects to the bus at address, e.g. a test bus or a
+// session bus that isn't in the environment.
+func NewServiceWithAddress(address string) (*SecretService, error) {
+	return newService(func(opts ...dbus.ConnOption) (*dbus.Conn, error) {
+		return dbus.Connect(address, opts...)
+	})
+}
+
+// NewServiceWithConn uses conn, which must be authenticated and must not be
+// shared, since Close closes it. The service can't reconnect if conn is lost,
+// so auto-reconnect is disabled.
+func NewServiceWithConn(conn *dbus.Conn) (*SecretService, error) {
+	used := false
+	s, err := newService(func(...dbus.ConnOption) (*dbus.Conn, error) {
+		if used {
+			return nil, errors.New("connection provided to NewServiceWithConn can't be reopened")
+		}
+		used = true
+		return conn, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.SetAutoReconnect(false)
+	return s, nil
+}
+
+func newService(connect func(...dbus.ConnOption) (*dbus.Conn, error)) (*SecretService, error) {
+	s := &SecretService{
+		connect:            connect,
+		sessionOpenTimeout: DefaultSessionOpenTimeout,
+		autoReconnect:      true,
+		sessions:           make(map[*Session]struct{}),
+	}
+	conn, signalCh, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+	s.signalCh = signalCh
+	s.monitor(conn)
+	return s, nil
+}
+
+// dial opens a connection, returning it with the channel prompt completion
+// signals are delivered on.
+func (s *SecretService) dial() (*dbus.Conn, <-chan *dbus.Signal, error) {
+	conn, err := s.connect()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to open dbus connection")
+		return nil, nil, errors.Wrap(err, "failed to open dbus connection")
 	}
+	allSignals := make(chan *dbus.Signal, 16)
+	conn.Signal(allSignals)
 	signalCh := make(chan *dbus.Signal, 16)
-	conn.Signal(signalCh)
-	_ = conn.AddMatchSignal(dbus.WithMatchOption("org.freedesktop.Secret.Prompt", "Completed"))
-	return &SecretService{conn: conn, signalCh: signalCh, sessionOpenTimeout: DefaultSessionOpenTimeout}, nil
+	go forwardPromptSignals(allSignals, signalCh)
+	if err := conn.AddMatchSignal(dbus.WithMatchOption("org.freedesktop.Secret.Prompt", "Completed")); err != nil {
+		logger().Warnf("failed to watch prompt completion signals: %v", err)
+	}
+	return conn, signalCh, nil
+}
+
+// forwardPromptSignals forwards the prompt completion signals from in to out
+// until in is closed. Other signals on the connection, e.g. those a Watcher
+// subscribes to, are dropped, as are completions when out is full because
+// nobody is waiting for a prompt, so in never fills up and blocks delivery.
+func forwardPromptSignals(in <-chan *dbus.Signal, out chan<- *dbus.Signal) {
+	defer close(out)
+	for signal := range in {
+		if signal == nil || signal.Name != "org.freedesktop.Secret.Prompt.Completed" {
+			continue
+		}
+		select {
+		case out <- signal:
+		default:
+			logger().Debugf("dropping prompt completion signal for %s", signal.Path)
+		}
+	}
+}
+
+// monitor reconnects when conn is lost. Signal channels are closed when the
+// connection is lost, so a dedicated channel notices promptly.
+func (s *SecretService) monitor(conn *dbus.Conn) {
+	monitorCh := make(chan *dbus.Signal, 16)
+	conn.Signal(monitorCh)
+	go func() {
+		for range monitorCh {
+		}
+		if err := s.reconnect(conn); err != nil {
+			logger().Warnf("failed to reconnect to dbus: %v", err)
+		}
+	}()
+}
+
+// reconnect replaces the lost connection dead, if it's still current and
+// auto-reconnect is enabled. The sessions open on dead are lost with it;
+// the managed session is re-opened by Session when it's next used.
+func (s *SecretService) reconnect(dead *dbus.Conn) error {
+	s.reconnectMu.Lock()
+	defer s.reconnectMu.Unlock()
+
+	s.mu.Lock()
+	if s.conn != dead || !s.autoReconnect || s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	logger().Warnf("dbus connection lost, reconnecting")
+	conn, signalCh, err := s.dial()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		_ = conn.Close()
+		return nil
+	}
+	s.conn = conn
+	s.signalCh = signalCh
+	s.sessions = make(map[*Session]struct{})
+	s.monitor(conn)
+	return nil
+}
+
+// currentConn returns the connection, reconnecting first if it was lost.
+func (s *SecretService) currentConn() *dbus.Conn {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn.Connected() {
+		return conn
+	}
+	if err := s.reconnect(conn); err != nil {
+		logger().Warnf("failed to reconnect to dbus: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn
+}
+
+// SetAutoReconnect sets whether a lost connection is replaced. It's enabled
+// by default. Sessions opened with OpenSession are lost with the connection
+// and must be opened again, along with secrets created with them; the
+// managed session (see Session) is re-opened automatically.
+func (s *SecretService) SetAutoReconnect(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autoReconnect = enabled
 }
 
 // SetSessionOpenTimeout
 func (s *SecretService) SetSessionOpenTimeout(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.sessionOpenTimeout = d
 }
 
 // ServiceObj
 func (s *SecretService) ServiceObj() dbus.BusObject {
-	return s.conn.Object(SecretServiceInterface, SecretServiceObjectPath)
+	return s.currentConn().Object(SecretServiceInterface, SecretServiceObjectPath)
 }
 
 // Obj
 func (s *SecretService) Obj(path dbus.ObjectPath) dbus.BusObject {
-	return s.conn.Object(SecretServiceInterface, path)
+	return s.currentConn().Object(SecretServiceInterface, path)
 }
 
 type sessionOpenResponse struct {
@@ -97,8 +267,8 @@ type sessionOpenResponse struct {
 	path            dbus.ObjectPath
 }
 
-func (s *SecretService) openSessionRaw(mode AuthenticationMode, sessionAlgorithmInput dbus.Variant) (resp sessionOpenResponse, err error) {
-	err = s.ServiceObj().
+func (s *SecretService) openSessionRaw(conn *dbus.Conn, mode AuthenticationMode, sessionAlgorithmInput dbus.Variant) (resp sessionOpenResponse, err error) {
+	err = conn.Object(SecretServiceInterface, SecretServiceObjectPath).
 		Call("org.freedesktop.Secret.Service.OpenSession", NilFlags, mode, sessionAlgorithmInput).
 		Store(&resp.algorithmOutput, &resp.path)
 	return resp, errors.Wrap(err, "failed to open secretservice session")
@@ -106,6 +276,17 @@ func (s *SecretService) openSessionRaw(mode AuthenticationMode, sessionAlgorithm
 
 // OpenSession
 func (s *SecretService) OpenSession(mode AuthenticationMode) (session *Session, err error) {
+	session, err = s.openSession(s.currentConn(), mode)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session] = struct{}{}
+	return session, nil
+}
+
+func (s *SecretService) openSession(conn *dbus.Conn, mode AuthenticationMode) (session *Session, err error) {
 	var sessionAlgorithmInput dbus.Variant
 
 	session = new(Session)
@@ -131,7 +312,7 @@ func (s *SecretService) OpenSession(mode AuthenticationMode) (session *Session,
 	sessionOpenCh := make(chan sessionOpenResponse)
 	errCh := make(chan error)
 	go func() {
-		sessionOpenResponse, err := s.openSessionRaw(mode, sessionAlgorithmInput)
+		sessionOpenResponse, err := s.openSessionRaw(conn, mode, sessionAlgorithmInput)
 		if err != nil {
 			errCh <- err
 		} else {
@@ -140,6 +321,9 @@ func (s *SecretService) OpenSession(mode AuthenticationMode) (session *Session,
 	}()
 
 	var sessionAlgorithmOutput dbus.Variant
+	s.mu.Lock()
+	timeout := s.sessionOpenTimeout
+	s.mu.Unlock()
 	// NOTE: If the timeout case is reached, the above goroutine is leaked.
 	// This is not terrible because D-Bus calls have an internal 2-mintue
 	// timeout, so the goroutine will finish eventually. If two OpenSessions
@@ -151,8 +335,8 @@ func (s *SecretService) OpenSession(mode AuthenticationMode) (session *Session,
 		session.Path = resp.path
 	case err := <-errCh:
 		return nil, err
-	case <-time.After(s.sessionOpenTimeout):
-		return nil, errors.Errorf("timed out after %s", s.sessionOpenTimeout)
+	case <-time.After(timeout):
+		return nil, errors.Errorf("timed out after %s", timeout)
 	}
 
 	switch mode {
@@ -177,9 +361,119 @@ func (s *SecretService) OpenSession(mode AuthenticationMode) (session *Session,
 	return session, nil
 }
 
+// Session returns the managed session, opening it on first use. A new
+// session is opened if the connection was lost since, or if ReadSecret
+// found it closed, so call Session each time rather than keeping the
+// session. It's closed by Close or CloseSession.
+func (s *SecretService) Session() (*Session, error) {
+	s.managedMu.Lock()
+	defer s.managedMu.Unlock()
+	// Reconnect first if needed, so a managed session lost with the
+	// connection is replaced.
+	s.currentConn()
+	if s.managed != nil {
+		s.mu.Lock()
+		_, open := s.sessions[s.managed]
+		s.mu.Unlock()
+		if open {
+			return s.managed, nil
+		}
+	}
+	session, err := s.OpenSession(AuthenticationDHAES)
+	if err != nil {
+		return nil, err
+	}
+	s.managed = session
+	return session, nil
+}
+
+// ReadSecret returns the secret of the item using the managed session. If
+// the session no longer exists, e.g. because the service restarted, it's
+// re-opened and the read retried once.
+func (s *SecretService) ReadSecret(item dbus.ObjectPath) (secretPlaintext []byte, err error) {
+	session, err := s.Session()
+	if err != nil {
+		return nil, err
+	}
+	secretPlaintext, err = s.GetSecret(item, *session)
+	if err == nil || !isNoSessionError(err, session.Path) {
+		return secretPlaintext, err
+	}
+	logger().Debugf("managed session is gone, re-opening: %v", err)
+	s.CloseSession(session)
+	session, err = s.Session()
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSecret(item, *session)
+}
+
+// isNoSessionError returns whether err says the session at path doesn't
+// exist.
+func isNoSessionError(err error, path dbus.ObjectPath) bool {
+	var dbusErr dbus.Error
+	switch e := errors.Cause(err).(type) {
+	case dbus.Error:
+		dbusErr = e
+	case *dbus.Error:
+		dbusErr = *e
+	default:
+		return false
+	}
+	switch dbusErr.Name {
+	case "org.freedesktop.Secret.Error.NoSession":
+		return true
+	case "org.freedesktop.DBus.Error.UnknownObject":
+		return strings.Contains(dbusErr.Error(), string(path))
+	}
+	return false
+}
+
+// Close closes the open sessions and the connection. The service can't be
+// used after it's closed.
+func (s *SecretService) Close() error {
+	s.managedMu.Lock()
+	s.managed = nil
+	s.managedMu.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	conn := s.conn
+	sessions := s.sessions
+	s.sessions = make(map[*Session]struct{})
+	s.mu.Unlock()
+
+	for session := range sessions {
+		s.closeSession(conn, session)
+	}
+	if err := conn.Close(); err != nil {
+		return errors.Wrap(err, "failed to close dbus connection")
+	}
+	return nil
+}
+
 // CloseSession
 func (s *SecretService) CloseSession(session *Session) {
-	s.Obj(session.Path).Call("org.freedesktop.Secret.Session.Close", NilFlags)
+	s.managedMu.Lock()
+	if s.managed == session {
+		s.managed = nil
+	}
+	s.managedMu.Unlock()
+	s.mu.Lock()
+	delete(s.sessions, session)
+	s.mu.Unlock()
+	s.closeSession(s.currentConn(), session)
+}
+
+func (s *SecretService) closeSession(conn *dbus.Conn, session *Session) {
+	call := conn.Object(SecretServiceInterface, session.Path).Call("org.freedesktop.Secret.Session.Close", NilFlags)
+	if call.Err != nil {
+		logger().Debugf("failed to close session %s: %v", session.Path, call.Err)
+	}
 }
 
 // SearchColleciton
@@ -193,6 +487,18 @@ func (s *SecretService) SearchCollection(collection dbus.ObjectPath, attributes
 	return items, nil
 }
 
+// SearchItems searches every collection for items with the attributes,
+// returning the unlocked and locked items separately.
+func (s *SecretService) SearchItems(attributes Attributes) (unlocked []dbus.ObjectPath, locked []dbus.ObjectPath, err error) {
+	err = s.ServiceObj().
+		Call("org.freedesktop.Secret.Service.SearchItems", NilFlags, attributes).
+		Store(&unlocked, &locked)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to search items")
+	}
+	return unlocked, locked, nil
+}
+
 // ReplaceBehavior
 type ReplaceBehavior int
 
@@ -244,6 +550,77 @@ func (s *SecretService) DeleteItem(item dbus.ObjectPath) (err error) {
 	return nil
 }
 
+// CollectionInfo
+type CollectionInfo struct {
+	Path   dbus.ObjectPath
+	Label  string
+	Locked bool
+}
+
+// ListCollections returns the collections of the service with their labels
+// and locked state.
+func (s *SecretService) ListCollections() (collections []CollectionInfo, err error) {
+	pathsV, err := s.ServiceObj().GetProperty("org.freedesktop.Secret.Service.Collections")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get collections")
+	}
+	paths, ok := pathsV.Value().([]dbus.ObjectPath)
+	if !ok {
+		return nil, errors.Errorf("failed to coerce collections")
+	}
+	for _, path := range paths {
+		label, err := s.GetCollectionLabel(path)
+		if err != nil {
+			return nil, err
+		}
+		locked, err := s.getLocked(path, "org.freedesktop.Secret.Collection")
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, CollectionInfo{Path: path, Label: label, Locked: locked})
+	}
+	return collections, nil
+}
+
+// GetCollectionLabel
+func (s *SecretService) GetCollectionLabel(collection dbus.ObjectPath) (label string, err error) {
+	labelV, err := s.Obj(collection).GetProperty("org.freedesktop.Secret.Collection.Label")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get collection label")
+	}
+	label, ok := labelV.Value().(string)
+	if !ok {
+		return "", errors.Errorf("failed to coerce collection label")
+	}
+	return label, nil
+}
+
+// SetCollectionLabel
+func (s *SecretService) SetCollectionLabel(collection dbus.ObjectPath, label string) (err error) {
+	err = s.Obj(collection).SetProperty("org.freedesktop.Secret.Collection.Label", dbus.MakeVariant(label))
+	if err != nil {
+		return errors.Wrap(err, "failed to set collection label")
+	}
+	return nil
+}
+
+// DeleteCollection deletes the collection and all its items. The user may be
+// prompted to confirm.
+func (s *SecretService) DeleteCollection(collection dbus.ObjectPath) (err error) {
+	var prompt dbus.ObjectPath
+	err = s.Obj(collection).
+		Call("org.freedesktop.Secret.Collection.Delete", NilFlags).
+		Store(&prompt)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete collection")
+	}
+	_, err = s.PromptAndWait(prompt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // GetAttributes
 func (s *SecretService) GetAttributes(item dbus.ObjectPath) (attributes Attributes, err error) {
 	attributesV, err := s.Obj(item).GetProperty("org.freedesktop.Secret.Item.Attributes")
@@ -257,35 +634,106 @@ func (s *SecretService) GetAttributes(item dbus.ObjectPath) (attributes Attribut
 	return Attributes(attributesMap), nil
 }
 
+func (s *SecretService) getItemTime(item dbus.ObjectPath, property string) (t time.Time, err error) {
+	v, err := s.Obj(item).GetProperty("org.freedesktop.Secret.Item." + property)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "failed to get item %s time", property)
+	}
+	secs, ok := v.Value().(uint64)
+	if !ok {
+		return time.Time{}, errors.Errorf("failed to coerce item %s time", property)
+	}
+	return time.Unix(int64(secs), 0), nil
+}
+
+// GetCreated returns when the item was created.
+func (s *SecretService) GetCreated(item dbus.ObjectPath) (created time.Time, err error) {
+	return s.getItemTime(item, "Created")
+}
+
+// GetModified returns when the item was last modified.
+func (s *SecretService) GetModified(item dbus.ObjectPath) (modified time.Time, err error) {
+	return s.getItemTime(item, "Modified")
+}
+
+// SetItemLabel
+func (s *SecretService) SetItemLabel(item dbus.ObjectPath, label string) (err error) {
+	err = s.Obj(item).SetProperty("org.freedesktop.Secret.Item.Label", dbus.MakeVariant(label))
+	if err != nil {
+		return errors.Wrap(err, "failed to set item label")
+	}
+	return nil
+}
+
+// SetItemAttributes replaces the attributes of the item. The item keeps its
+// path, unlike deleting and recreating it.
+func (s *SecretService) SetItemAttributes(item dbus.ObjectPath, attributes Attributes) (err error) {
+	err = s.Obj(item).SetProperty("org.freedesktop.Secret.Item.Attributes", dbus.MakeVariant(map[string]string(attributes)))
+	if err != nil {
+		return errors.Wrap(err, "failed to set item attributes")
+	}
+	return nil
+}
+
 // GetSecret
 func (s *SecretService) GetSecret(item dbus.ObjectPath, session Session) (secretPlaintext []byte, err error) {
+	secretPlaintext, _, err = s.GetSecretWithContentType(item, session)
+	return secretPlaintext, err
+}
+
+// GetSecretWithContentType returns the secret of the item and its content
+// type, e.g. "text/plain" for secrets stored by libsecret.
+func (s *SecretService) GetSecretWithContentType(item dbus.ObjectPath, session Session) (secretPlaintext []byte, contentType string, err error) {
 	var secretI []interface{}
 	err = s.Obj(item).
 		Call("org.freedesktop.Secret.Item.GetSecret", NilFlags, session.Path).
 		Store(&secretI)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get secret")
+		return nil, "", errors.Wrap(err, "failed to get secret")
 	}
 	secret := new(Secret)
 	err = dbus.Store(secretI, &secret.Session, &secret.Parameters, &secret.Value, &secret.ContentType)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to unmarshal get secret result")
+		return nil, "", errors.Wrap(err, "failed to unmarshal get secret result")
 	}
+	secretPlaintext, err = session.decrypt(*secret)
+	if err != nil {
+		return nil, "", err
+	}
+	return secretPlaintext, secret.ContentType, nil
+}
 
-	switch session.Mode {
-	case AuthenticationInsecurePlain:
-		secretPlaintext = secret.Value
-	case AuthenticationDHAES:
-		plaintext, err := unauthenticatedAESCBCDecrypt(secret.Parameters, secret.Value, session.AESKey)
+// GetSecrets returns the secrets of the items in one call, keyed by item
+// path. Locked items are omitted.
+func (s *SecretService) GetSecrets(items []dbus.ObjectPath, session Session) (secretPlaintexts map[dbus.ObjectPath][]byte, err error) {
+	var secrets map[dbus.ObjectPath]Secret
+	err = s.ServiceObj().
+		Call("org.freedesktop.Secret.Service.GetSecrets", NilFlags, items, session.Path).
+		Store(&secrets)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get secrets")
+	}
+	secretPlaintexts = make(map[dbus.ObjectPath][]byte, len(secrets))
+	for item, secret := range secrets {
+		plaintext, err := session.decrypt(secret)
 		if err != nil {
-			return nil, nil
+			return nil, err
 		}
-		secretPlaintext = plaintext
-	default:
-		return nil, errors.Errorf("cannot make secret for authentication mode %v", session.Mode)
+		secretPlaintexts[item] = plaintext
 	}
+	return secretPlaintexts, nil
+}
 
-	return secretPlaintext, nil
+// SetSecret replaces the secret of the item, keeping its path and
+// attributes. Create the secret with the session's NewSecret.
+func (s *SecretService) SetSecret(item dbus.ObjectPath, secret Secret) (err error) {
+	err = s.Obj(item).
+		Call("org.freedesktop.Secret.Item.SetSecret", NilFlags, secret).
+		Err
+	if err != nil {
+		return errors.Wrap(err, "failed to set secret")
+	}
+	return nil
 }
 
 // NullPrompt
@@ -293,36 +741,92 @@ const NullPrompt = "/"
 
 // Unlock
 func (s *SecretService) Unlock(items []dbus.ObjectPath) (err error) {
-	var dummy []dbus.ObjectPath
-	var prompt dbus.ObjectPath
-	err = s.ServiceObj().
-		Call("org.freedesktop.Secret.Service.Unlock", NilFlags, items).
-		Store(&dummy, &prompt)
-	if err != nil {
-		return errors.Wrap(err, "failed to unlock items")
-	}
-	_, err = s.PromptAndWait(prompt)
+	_, err = s.UnlockPaths(items)
+	return err
+}
+
+// UnlockPaths unlocks the items or collections, returning the paths that
+// were unlocked, including those unlocked after prompting.
+func (s *SecretService) UnlockPaths(items []dbus.ObjectPath) (unlocked []dbus.ObjectPath, err error) {
+	unlocked, err = s.lockOrUnlock("org.freedesktop.Secret.Service.Unlock", items)
 	if err != nil {
-		return errors.Wrap(err, "failed to prompt")
+		return nil, errors.Wrap(err, "failed to unlock items")
 	}
-	return nil
+	logger().Debugf("unlocked %v", unlocked)
+	return unlocked, nil
 }
 
 // LockItems
 func (s *SecretService) LockItems(items []dbus.ObjectPath) (err error) {
-	var dummy []dbus.ObjectPath
+	_, err = s.LockPaths(items)
+	return err
+}
+
+// LockPaths locks the items or collections, returning the paths that were
+// locked, including those locked after prompting.
+func (s *SecretService) LockPaths(items []dbus.ObjectPath) (locked []dbus.ObjectPath, err error) {
+	locked, err = s.lockOrUnlock("org.freedesktop.Secret.Service.Lock", items)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock items")
+	}
+	logger().Debugf("locked %v", locked)
+	return locked, nil
+}
+
+func (s *SecretService) lockOrUnlock(method string, items []dbus.ObjectPath) (paths []dbus.ObjectPath, err error) {
 	var prompt dbus.ObjectPath
 	err = s.ServiceObj().
-		Call("org.freedesktop.Secret.Service.Lock", NilFlags, items).
-		Store(&dummy, &prompt)
+		Call(method, NilFlags, items).
+		Store(&paths, &prompt)
 	if err != nil {
-		return errors.Wrap(err, "failed to lock items")
+		return nil, err
 	}
-	_, err = s.PromptAndWait(prompt)
+	promptedV, err := s.PromptAndWait(prompt)
 	if err != nil {
-		return errors.Wrap(err, "failed to prompt")
+		return nil, errors.Wrap(err, "failed to prompt")
 	}
-	return nil
+	if promptedV != nil {
+		prompted, ok := promptedV.Value().([]dbus.ObjectPath)
+		if !ok {
+			return nil, errors.Errorf("failed to coerce prompt result")
+		}
+		paths = append(paths, prompted...)
+	}
+	return paths, nil
+}
+
+func (s *SecretService) getLocked(path dbus.ObjectPath, iface string) (locked bool, err error) {
+	lockedV, err := s.Obj(path).GetProperty(iface + ".Locked")
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get locked state")
+	}
+	locked, ok := lockedV.Value().(bool)
+	if !ok {
+		return false, errors.Errorf("failed to coerce locked state")
+	}
+	return locked, nil
+}
+
+// IsLocked returns whether the item or collection is locked, i.e. whether
+// it must be unlocked before its secrets can be read.
+func (s *SecretService) IsLocked(path dbus.ObjectPath) (locked bool, err error) {
+	locked, err = s.getLocked(path, "org.freedesktop.Secret.Item")
+	if err == nil {
+		return locked, nil
+	}
+	return s.getLocked(path, "org.freedesktop.Secret.Collection")
+}
+
+// GetLocked returns the locked state of each item or collection.
+func (s *SecretService) GetLocked(paths []dbus.ObjectPath) (locked map[dbus.ObjectPath]bool, err error) {
+	locked = make(map[dbus.ObjectPath]bool, len(paths))
+	for _, path := range paths {
+		locked[path], err = s.IsLocked(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return locked, nil
 }
 
 // PromptDismissedError
@@ -344,10 +848,13 @@ func (s *SecretService) PromptAndWait(prompt dbus.ObjectPath) (paths *dbus.Varia
 	if call.Err != nil {
 		return nil, errors.Wrap(err, "failed to prompt")
 	}
+	s.mu.Lock()
+	signalCh := s.signalCh
+	s.mu.Unlock()
 	for {
 		var result PromptCompletedResult
 		select {
-		case signal, ok := <-s.signalCh:
+		case signal, ok := <-signalCh:
 			if !ok {
 				return nil, errors.New("prompt channel closed")
 			}
@@ -379,15 +886,39 @@ func NewSecretProperties(label string, attributes map[string]string) map[string]
 	}
 }
 
+func (session *Session) decrypt(secret Secret) (secretPlaintext []byte, err error) {
+	switch session.Mode {
+	case AuthenticationInsecurePlain:
+		return secret.Value, nil
+	case AuthenticationDHAES:
+		plaintext, err := unauthenticatedAESCBCDecrypt(secret.Parameters, secret.Value, session.AESKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt secret")
+		}
+		return plaintext, nil
+	default:
+		return nil, errors.Errorf("cannot make secret for authentication mode %v", session.Mode)
+	}
+}
+
+// DefaultContentType
+const DefaultContentType = "application/octet-stream"
+
 // NewSecret
 func (session *Session) NewSecret(secretBytes []byte) (Secret, error) {
+	return session.NewSecretWithContentType(secretBytes, DefaultContentType)
+}
+
+// NewSecretWithContentType creates a secret with the content type, e.g.
+// "text/plain" for passwords read by libsecret applications.
+func (session *Session) NewSecretWithContentType(secretBytes []byte, contentType string) (Secret, error) {
 	switch session.Mode {
 	case AuthenticationInsecurePlain:
 		return Secret{
 			Session:     session.Path,
 			Parameters:  nil,
 			Value:       secretBytes,
-			ContentType: "application/octet-stream",
+			ContentType: contentType,
 		}, nil
 	case AuthenticationDHAES:
 		iv, ciphertext, err := unauthenticatedAESCBCEncrypt(secretBytes, session.AESKey)
@@ -398,7 +929,7 @@ func (session *Session) NewSecret(secretBytes []byte) (Secret, error) {
 			Session:     session.Path,
 			Parameters:  iv,
 			Value:       ciphertext,
-			ContentType: "application/octet-stream",
+			ContentType: contentType,
 		}, nil
 	default:
 		return Secret{}, errors.Errorf("cannot make secret for authentication mode %v", session.Mode)
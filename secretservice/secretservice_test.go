@@ -8,7 +8,9 @@
 package secretservice
 
 import (
+	"os"
 	"testing"
+	"time"
 
 	dbus "github.com/keybase/dbus"
 	"github.com/stretchr/testify/require"
@@ -85,3 +87,415 @@ func TestGetAll(t *testing.T) {
 	err = srv.DeleteItem(item)
 	require.NoError(t, err)
 }
+
+func createTestCollection(t *testing.T, srv *SecretService, label string) dbus.ObjectPath {
+	properties := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Collection.Label": dbus.MakeVariant(label),
+	}
+	var collection, prompt dbus.ObjectPath
+	err := srv.ServiceObj().
+		Call("org.freedesktop.Secret.Service.CreateCollection", NilFlags, properties, "").
+		Store(&collection, &prompt)
+	require.NoError(t, err)
+	paths, err := srv.PromptAndWait(prompt)
+	require.NoError(t, err)
+	if paths != nil {
+		collection = paths.Value().(dbus.ObjectPath)
+	}
+	return collection
+}
+
+func TestDeleteCollection(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+
+	collection := createTestCollection(t, srv, "TestDeleteCollection")
+	err = srv.DeleteCollection(collection)
+	require.NoError(t, err)
+
+	_, err = srv.SearchCollection(collection, map[string]string{"foo": "bar"})
+	require.Error(t, err)
+}
+
+func TestListCollections(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+
+	collection := createTestCollection(t, srv, "TestListCollections")
+	defer func() { require.NoError(t, srv.DeleteCollection(collection)) }()
+
+	collections, err := srv.ListCollections()
+	require.NoError(t, err)
+	found := false
+	for _, c := range collections {
+		if c.Path == collection {
+			found = true
+			require.Equal(t, "TestListCollections", c.Label)
+		}
+	}
+	require.True(t, found)
+}
+
+func TestCollectionLabel(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+
+	collection := createTestCollection(t, srv, "TestCollectionLabel")
+	defer func() { require.NoError(t, srv.DeleteCollection(collection)) }()
+
+	label, err := srv.GetCollectionLabel(collection)
+	require.NoError(t, err)
+	require.Equal(t, "TestCollectionLabel", label)
+
+	err = srv.SetCollectionLabel(collection, "TestCollectionLabel renamed")
+	require.NoError(t, err)
+	label, err = srv.GetCollectionLabel(collection)
+	require.NoError(t, err)
+	require.Equal(t, "TestCollectionLabel renamed", label)
+}
+
+func TestSetItemLabelAndAttributes(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+	session, err := srv.OpenSession(AuthenticationDHAES)
+	require.NoError(t, err)
+	defer srv.CloseSession(session)
+
+	collection := DefaultCollection
+	err = srv.Unlock([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+
+	secret, err := session.NewSecret([]byte("secret"))
+	require.NoError(t, err)
+	item, err := srv.CreateItem(collection, NewSecretProperties("testlabel", map[string]string{"username": "testuser"}), secret, ReplaceBehaviorReplace)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv.DeleteItem(item)) }()
+
+	err = srv.SetItemLabel(item, "testlabel renamed")
+	require.NoError(t, err)
+	labelV, err := srv.Obj(item).GetProperty("org.freedesktop.Secret.Item.Label")
+	require.NoError(t, err)
+	require.Equal(t, "testlabel renamed", labelV.Value())
+
+	err = srv.SetItemAttributes(item, Attributes{"username": "renameduser"})
+	require.NoError(t, err)
+	attrs, err := srv.GetAttributes(item)
+	require.NoError(t, err)
+	require.Equal(t, "renameduser", attrs["username"])
+
+	items, err := srv.SearchCollection(collection, map[string]string{"username": "renameduser"})
+	require.NoError(t, err)
+	require.Equal(t, []dbus.ObjectPath{item}, items)
+}
+
+func TestSetSecret(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+	session, err := srv.OpenSession(AuthenticationDHAES)
+	require.NoError(t, err)
+	defer srv.CloseSession(session)
+
+	collection := DefaultCollection
+	err = srv.Unlock([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+
+	secret, err := session.NewSecret([]byte("secret"))
+	require.NoError(t, err)
+	item, err := srv.CreateItem(collection, NewSecretProperties("testlabel", map[string]string{"username": "testuser"}), secret, ReplaceBehaviorReplace)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv.DeleteItem(item)) }()
+
+	rotated, err := session.NewSecret([]byte("rotated"))
+	require.NoError(t, err)
+	err = srv.SetSecret(item, rotated)
+	require.NoError(t, err)
+
+	secretPlaintext, err := srv.GetSecret(item, *session)
+	require.NoError(t, err)
+	require.Equal(t, []byte("rotated"), secretPlaintext)
+	attrs, err := srv.GetAttributes(item)
+	require.NoError(t, err)
+	require.Equal(t, "testuser", attrs["username"])
+}
+
+func TestIsLocked(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+	session, err := srv.OpenSession(AuthenticationDHAES)
+	require.NoError(t, err)
+	defer srv.CloseSession(session)
+
+	collection := DefaultCollection
+	err = srv.Unlock([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+
+	secret, err := session.NewSecret([]byte("secret"))
+	require.NoError(t, err)
+	item, err := srv.CreateItem(collection, NewSecretProperties("testlabel", map[string]string{"username": "testuser"}), secret, ReplaceBehaviorReplace)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv.DeleteItem(item)) }()
+
+	locked, err := srv.IsLocked(collection)
+	require.NoError(t, err)
+	require.False(t, locked)
+
+	states, err := srv.GetLocked([]dbus.ObjectPath{collection, item})
+	require.NoError(t, err)
+	require.Equal(t, map[dbus.ObjectPath]bool{collection: false, item: false}, states)
+}
+
+func TestItemTimes(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+	session, err := srv.OpenSession(AuthenticationDHAES)
+	require.NoError(t, err)
+	defer srv.CloseSession(session)
+
+	collection := DefaultCollection
+	err = srv.Unlock([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+
+	before := time.Now().Add(-time.Minute)
+	secret, err := session.NewSecret([]byte("secret"))
+	require.NoError(t, err)
+	item, err := srv.CreateItem(collection, NewSecretProperties("testlabel", map[string]string{"username": "testuser"}), secret, ReplaceBehaviorReplace)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv.DeleteItem(item)) }()
+
+	created, err := srv.GetCreated(item)
+	require.NoError(t, err)
+	require.True(t, created.After(before))
+	modified, err := srv.GetModified(item)
+	require.NoError(t, err)
+	require.False(t, modified.Before(created))
+}
+
+func TestSearchItems(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+	session, err := srv.OpenSession(AuthenticationDHAES)
+	require.NoError(t, err)
+	defer srv.CloseSession(session)
+
+	collection := DefaultCollection
+	err = srv.Unlock([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+
+	secret, err := session.NewSecret([]byte("secret"))
+	require.NoError(t, err)
+	item, err := srv.CreateItem(collection, NewSecretProperties("testlabel", map[string]string{"searchitems": "test"}), secret, ReplaceBehaviorReplace)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv.DeleteItem(item)) }()
+
+	unlocked, locked, err := srv.SearchItems(Attributes{"searchitems": "test"})
+	require.NoError(t, err)
+	require.Equal(t, []dbus.ObjectPath{item}, unlocked)
+	require.Empty(t, locked)
+}
+
+func TestGetSecrets(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+	session, err := srv.OpenSession(AuthenticationDHAES)
+	require.NoError(t, err)
+	defer srv.CloseSession(session)
+
+	collection := DefaultCollection
+	err = srv.Unlock([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+
+	expected := map[dbus.ObjectPath][]byte{}
+	for _, username := range []string{"testuser1", "testuser2"} {
+		secret, err := session.NewSecret([]byte("secret " + username))
+		require.NoError(t, err)
+		item, err := srv.CreateItem(collection, NewSecretProperties("testlabel", map[string]string{"username": username}), secret, ReplaceBehaviorReplace)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, srv.DeleteItem(item)) }()
+		expected[item] = []byte("secret " + username)
+	}
+
+	items := make([]dbus.ObjectPath, 0, len(expected))
+	for item := range expected {
+		items = append(items, item)
+	}
+	secrets, err := srv.GetSecrets(items, *session)
+	require.NoError(t, err)
+	require.Equal(t, expected, secrets)
+}
+
+func TestContentType(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+	session, err := srv.OpenSession(AuthenticationDHAES)
+	require.NoError(t, err)
+	defer srv.CloseSession(session)
+
+	collection := DefaultCollection
+	err = srv.Unlock([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+
+	secret, err := session.NewSecretWithContentType([]byte("secret"), "text/plain")
+	require.NoError(t, err)
+	item, err := srv.CreateItem(collection, NewSecretProperties("testlabel", map[string]string{"username": "testuser"}), secret, ReplaceBehaviorReplace)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv.DeleteItem(item)) }()
+
+	secretPlaintext, contentType, err := srv.GetSecretWithContentType(item, *session)
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), secretPlaintext)
+	require.Equal(t, "text/plain", contentType)
+}
+
+func TestWatch(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+	session, err := srv.OpenSession(AuthenticationDHAES)
+	require.NoError(t, err)
+	defer srv.CloseSession(session)
+
+	collection := DefaultCollection
+	err = srv.Unlock([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+
+	watcher, err := srv.Watch()
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	secret, err := session.NewSecret([]byte("secret"))
+	require.NoError(t, err)
+	item, err := srv.CreateItem(collection, NewSecretProperties("testlabel", map[string]string{"username": "testwatch"}), secret, ReplaceBehaviorReplace)
+	require.NoError(t, err)
+	err = srv.DeleteItem(item)
+	require.NoError(t, err)
+
+	var events []EventType
+	timeout := time.After(5 * time.Second)
+	for len(events) == 0 || events[len(events)-1] != EventItemDeleted {
+		select {
+		case event := <-watcher.Events:
+			if event.Path == item {
+				events = append(events, event.Type)
+			}
+		case <-timeout:
+			t.Fatalf("timed out with events %v", events)
+		}
+	}
+	require.Equal(t, EventItemCreated, events[0])
+
+	watcher.Close()
+	for range watcher.Events {
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+	session, err := srv.OpenSession(AuthenticationDHAES)
+	require.NoError(t, err)
+	defer srv.CloseSession(session)
+
+	collection := DefaultCollection
+	err = srv.Unlock([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+
+	secret, err := session.NewSecret([]byte("secret"))
+	require.NoError(t, err)
+	item, err := srv.CreateItem(collection, NewSecretProperties("testlabel", map[string]string{"username": "testreconnect"}), secret, ReplaceBehaviorReplace)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv.DeleteItem(item)) }()
+
+	managed, err := srv.Session()
+	require.NoError(t, err)
+	opened := *session
+
+	require.NoError(t, srv.currentConn().Close())
+	_, err = srv.ListCollections()
+	require.NoError(t, err)
+	// Sessions held by the caller aren't modified; the managed session is
+	// re-opened.
+	require.Equal(t, opened, *session)
+	reopened, err := srv.Session()
+	require.NoError(t, err)
+	require.NotSame(t, managed, reopened)
+	secretPlaintext, err := srv.ReadSecret(item)
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), secretPlaintext)
+
+	srv.SetAutoReconnect(false)
+	require.NoError(t, srv.currentConn().Close())
+	_, err = srv.ListCollections()
+	require.Error(t, err)
+	srv.SetAutoReconnect(true)
+}
+
+func TestManagedSession(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	session, err := srv.Session()
+	require.NoError(t, err)
+	again, err := srv.Session()
+	require.NoError(t, err)
+	require.Same(t, session, again)
+
+	collection := DefaultCollection
+	err = srv.Unlock([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+
+	secret, err := session.NewSecret([]byte("secret"))
+	require.NoError(t, err)
+	item, err := srv.CreateItem(collection, NewSecretProperties("testlabel", map[string]string{"username": "testmanaged"}), secret, ReplaceBehaviorReplace)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv.DeleteItem(item)) }()
+
+	secretPlaintext, err := srv.ReadSecret(item)
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), secretPlaintext)
+
+	// A session closed behind the service's back is re-opened.
+	call := srv.Obj(session.Path).Call("org.freedesktop.Secret.Session.Close", NilFlags)
+	require.NoError(t, call.Err)
+	secretPlaintext, err = srv.ReadSecret(item)
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), secretPlaintext)
+
+	srv.CloseSession(session)
+	reopened, err := srv.Session()
+	require.NoError(t, err)
+	require.NotSame(t, session, reopened)
+}
+
+func TestNewServiceWithConn(t *testing.T) {
+	conn, err := dbus.ConnectSessionBus()
+	require.NoError(t, err)
+	srv, err := NewServiceWithConn(conn)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	_, err = srv.ListCollections()
+	require.NoError(t, err)
+
+	srv2, err := NewServiceWithAddress(os.Getenv("DBUS_SESSION_BUS_ADDRESS"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv2.Close()) }()
+	_, err = srv2.ListCollections()
+	require.NoError(t, err)
+}
+
+func TestLockPaths(t *testing.T) {
+	srv, err := NewService()
+	require.NoError(t, err)
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	collection := createTestCollection(t, srv, "TestLockPaths")
+	defer func() { require.NoError(t, srv.DeleteCollection(collection)) }()
+
+	locked, err := srv.LockPaths([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+	require.Equal(t, []dbus.ObjectPath{collection}, locked)
+
+	unlocked, err := srv.UnlockPaths([]dbus.ObjectPath{collection})
+	require.NoError(t, err)
+	require.Equal(t, []dbus.ObjectPath{collection}, unlocked)
+}
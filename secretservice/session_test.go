@@ -0,0 +1,26 @@
+package secretservice
+
+import (
+	"testing"
+
+	dbus "github.com/keybase/dbus"
+	errors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsNoSessionError(t *testing.T) {
+	session := dbus.ObjectPath("/org/freedesktop/secrets/session/1")
+
+	noSession := dbus.Error{Name: "org.freedesktop.Secret.Error.NoSession", Body: []interface{}{"The session does not exist"}}
+	require.True(t, isNoSessionError(errors.Wrap(noSession, "failed to get secret"), session))
+	require.True(t, isNoSessionError(&noSession, session))
+
+	unknownSession := dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownObject", Body: []interface{}{"No such object " + string(session)}}
+	require.True(t, isNoSessionError(unknownSession, session))
+
+	unknownItem := dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownObject", Body: []interface{}{"No such object /org/freedesktop/secrets/collection/login/1"}}
+	require.False(t, isNoSessionError(unknownItem, session))
+	locked := dbus.Error{Name: "org.freedesktop.Secret.Error.IsLocked", Body: []interface{}{"Cannot get secret of a locked object"}}
+	require.False(t, isNoSessionError(locked, session))
+	require.False(t, isNoSessionError(errors.New("failed"), session))
+}
@@ -0,0 +1,136 @@
+package secretservice
+
+import (
+	"sync"
+
+	dbus "github.com/keybase/dbus"
+	errors "github.com/pkg/errors"
+)
+
+// EventType is the name of the signal that caused an Event
+type EventType string
+
+const (
+	// EventItemCreated
+	EventItemCreated EventType = "ItemCreated"
+	// EventItemChanged
+	EventItemChanged EventType = "ItemChanged"
+	// EventItemDeleted
+	EventItemDeleted EventType = "ItemDeleted"
+	// EventCollectionCreated
+	EventCollectionCreated EventType = "CollectionCreated"
+	// EventCollectionChanged
+	EventCollectionChanged EventType = "CollectionChanged"
+	// EventCollectionDeleted
+	EventCollectionDeleted EventType = "CollectionDeleted"
+)
+
+// Event is a change to an item or collection.
+type Event struct {
+	Type EventType
+	// Path is the item or collection that changed
+	Path dbus.ObjectPath
+	// Collection is the collection of the item for item events
+	Collection dbus.ObjectPath
+}
+
+var watchMatches = [][]dbus.MatchOption{
+	{dbus.WithMatchInterface("org.freedesktop.Secret.Collection")},
+	{dbus.WithMatchInterface("org.freedesktop.Secret.Service")},
+}
+
+// Watcher delivers item and collection change events.
+type Watcher struct {
+	// Events is closed when the watcher is closed or the connection is lost
+	Events <-chan Event
+
+	conn      *dbus.Conn
+	signalCh  chan *dbus.Signal
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Watch subscribes to item and collection changes, e.g. another process
+// rotating or deleting a secret. Close the watcher when done.
+func (s *SecretService) Watch() (*Watcher, error) {
+	conn := s.currentConn()
+	for i, match := range watchMatches {
+		if err := conn.AddMatchSignal(match...); err != nil {
+			for _, added := range watchMatches[:i] {
+				_ = conn.RemoveMatchSignal(added...)
+			}
+			return nil, errors.Wrap(err, "failed to watch signals")
+		}
+	}
+	events := make(chan Event, 16)
+	w := &Watcher{
+		Events:   events,
+		conn:     conn,
+		signalCh: make(chan *dbus.Signal, 16),
+		done:     make(chan struct{}),
+	}
+	conn.Signal(w.signalCh)
+	go w.run(events)
+	return w, nil
+}
+
+func (w *Watcher) run(events chan<- Event) {
+	defer close(events)
+	for {
+		select {
+		case signal, ok := <-w.signalCh:
+			if !ok {
+				return
+			}
+			event, ok := eventFromSignal(signal)
+			if !ok {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-w.done:
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Close stops delivering events.
+func (w *Watcher) Close() {
+	w.closeOnce.Do(func() {
+		w.conn.RemoveSignal(w.signalCh)
+		for _, match := range watchMatches {
+			if err := w.conn.RemoveMatchSignal(match...); err != nil {
+				logger().Debugf("failed to remove signal match: %v", err)
+			}
+		}
+		close(w.done)
+	})
+}
+
+func eventFromSignal(signal *dbus.Signal) (event Event, ok bool) {
+	if signal == nil || len(signal.Body) != 1 {
+		return Event{}, false
+	}
+	path, ok := signal.Body[0].(dbus.ObjectPath)
+	if !ok {
+		return Event{}, false
+	}
+	switch signal.Name {
+	case "org.freedesktop.Secret.Collection.ItemCreated":
+		return Event{Type: EventItemCreated, Path: path, Collection: signal.Path}, true
+	case "org.freedesktop.Secret.Collection.ItemChanged":
+		return Event{Type: EventItemChanged, Path: path, Collection: signal.Path}, true
+	case "org.freedesktop.Secret.Collection.ItemDeleted":
+		return Event{Type: EventItemDeleted, Path: path, Collection: signal.Path}, true
+	case "org.freedesktop.Secret.Service.CollectionCreated":
+		return Event{Type: EventCollectionCreated, Path: path}, true
+	case "org.freedesktop.Secret.Service.CollectionChanged":
+		return Event{Type: EventCollectionChanged, Path: path}, true
+	case "org.freedesktop.Secret.Service.CollectionDeleted":
+		return Event{Type: EventCollectionDeleted, Path: path}, true
+	}
+	return Event{}, false
+}
@@ -0,0 +1,57 @@
+package secretservice
+
+import (
+	"testing"
+
+	dbus "github.com/keybase/dbus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventFromSignal(t *testing.T) {
+	collection := dbus.ObjectPath("/org/freedesktop/secrets/collection/login")
+	item := dbus.ObjectPath("/org/freedesktop/secrets/collection/login/1")
+
+	event, ok := eventFromSignal(&dbus.Signal{
+		Path: collection,
+		Name: "org.freedesktop.Secret.Collection.ItemChanged",
+		Body: []interface{}{item},
+	})
+	require.True(t, ok)
+	require.Equal(t, Event{Type: EventItemChanged, Path: item, Collection: collection}, event)
+
+	event, ok = eventFromSignal(&dbus.Signal{
+		Path: SecretServiceObjectPath,
+		Name: "org.freedesktop.Secret.Service.CollectionDeleted",
+		Body: []interface{}{collection},
+	})
+	require.True(t, ok)
+	require.Equal(t, Event{Type: EventCollectionDeleted, Path: collection}, event)
+
+	_, ok = eventFromSignal(&dbus.Signal{
+		Name: "org.freedesktop.Secret.Prompt.Completed",
+		Body: []interface{}{false, dbus.MakeVariant("")},
+	})
+	require.False(t, ok)
+	_, ok = eventFromSignal(nil)
+	require.False(t, ok)
+}
+
+func TestForwardPromptSignals(t *testing.T) {
+	in := make(chan *dbus.Signal)
+	out := make(chan *dbus.Signal, 16)
+	go forwardPromptSignals(in, out)
+
+	// Watch signals and completions nobody waits for must not block delivery.
+	for i := 0; i < 100; i++ {
+		in <- &dbus.Signal{Name: "org.freedesktop.Secret.Collection.ItemChanged"}
+		in <- &dbus.Signal{Name: "org.freedesktop.Secret.Prompt.Completed"}
+	}
+	close(in)
+
+	n := 0
+	for signal := range out {
+		require.Equal(t, "org.freedesktop.Secret.Prompt.Completed", signal.Name)
+		n++
+	}
+	require.GreaterOrEqual(t, n, 16)
+}
@@ -0,0 +1,108 @@
+//go:build darwin && ios
+// +build darwin,ios
+
+package keychain
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security -framework Foundation
+
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+
+#include "sharedwebcredentials.h"
+*/
+import "C"
+
+// SharedPasswordKey is for kSecSharedPassword
+var SharedPasswordKey = attrKey(C.CFTypeRef(C.kSecSharedPassword))
+
+// SharedWebCredential is a website password shared with Safari
+type SharedWebCredential struct {
+	Server   string
+	Account  string
+	Password string
+}
+
+// AddSharedWebCredential saves the password for account on the website fqdn,
+// which must be one of the app's associated domains. If password is empty,
+// the credential is deleted. This blocks until Safari has saved the
+// credential, so it must not be called from the main thread.
+func AddSharedWebCredential(fqdn string, account string, password string) error {
+	cfFQDN, err := StringToCFString(fqdn)
+	if err != nil {
+		return err
+	}
+	defer Release(C.CFTypeRef(cfFQDN))
+	cfAccount, err := StringToCFString(account)
+	if err != nil {
+		return err
+	}
+	defer Release(C.CFTypeRef(cfAccount))
+	var cfPassword C.CFStringRef
+	if password != "" {
+		cfPassword, err = StringToCFString(password)
+		if err != nil {
+			return err
+		}
+		defer Release(C.CFTypeRef(cfPassword))
+	}
+
+	cfErr := C.SharedWebCredentialAdd(cfFQDN, cfAccount, cfPassword)
+	if cfErr != 0 {
+		defer Release(C.CFTypeRef(cfErr))
+		return CFErrorError(cfErr)
+	}
+	return nil
+}
+
+// RequestSharedWebCredentials asks the user to pick a website password shared
+// with Safari. If fqdn is empty, credentials for all of the app's associated
+// domains are offered; if account is empty, all accounts are offered. This
+// blocks until the user responds, so it must not be called from the main
+// thread.
+func RequestSharedWebCredentials(fqdn string, account string) ([]SharedWebCredential, error) {
+	var cfFQDN, cfAccount C.CFStringRef
+	var err error
+	if fqdn != "" {
+		cfFQDN, err = StringToCFString(fqdn)
+		if err != nil {
+			return nil, err
+		}
+		defer Release(C.CFTypeRef(cfFQDN))
+	}
+	if account != "" {
+		cfAccount, err = StringToCFString(account)
+		if err != nil {
+			return nil, err
+		}
+		defer Release(C.CFTypeRef(cfAccount))
+	}
+
+	var cfErr C.CFErrorRef
+	cfArray := C.SharedWebCredentialRequest(cfFQDN, cfAccount, &cfErr) //nolint
+	if cfErr != 0 {
+		defer Release(C.CFTypeRef(cfErr))
+		return nil, CFErrorError(cfErr)
+	}
+	if cfArray == 0 {
+		return nil, nil
+	}
+	defer Release(C.CFTypeRef(cfArray))
+
+	var credentials []SharedWebCredential
+	for _, ref := range CFArrayToArray(cfArray) {
+		var credential SharedWebCredential
+		for k, v := range CFDictionaryToMap(C.CFDictionaryRef(ref)) {
+			switch keyString(k) {
+			case ServerKey:
+				credential.Server = CFStringToString(C.CFStringRef(v))
+			case AccountKey:
+				credential.Account = CFStringToString(C.CFStringRef(v))
+			case SharedPasswordKey:
+				credential.Password = CFStringToString(C.CFStringRef(v))
+			}
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, nil
+}
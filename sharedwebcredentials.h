@@ -0,0 +1,10 @@
+#include <CoreFoundation/CoreFoundation.h>
+
+// SharedWebCredentialAdd calls SecAddSharedWebCredential and waits for it to
+// complete, returning a retained error or NULL on success.
+CFErrorRef SharedWebCredentialAdd(CFStringRef fqdn, CFStringRef account, CFStringRef password);
+
+// SharedWebCredentialRequest calls SecRequestSharedWebCredential and waits for
+// it to complete, returning the retained credentials or NULL and setting
+// error to a retained error on failure.
+CFArrayRef SharedWebCredentialRequest(CFStringRef fqdn, CFStringRef account, CFErrorRef *error);
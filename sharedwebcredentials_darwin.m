@@ -0,0 +1,39 @@
+//go:build darwin && ios
+// +build darwin,ios
+
+#import <Foundation/Foundation.h>
+#import <Security/Security.h>
+
+#include "sharedwebcredentials.h"
+
+CFErrorRef SharedWebCredentialAdd(CFStringRef fqdn, CFStringRef account, CFStringRef password) {
+  __block CFErrorRef result = NULL;
+  dispatch_semaphore_t done = dispatch_semaphore_create(0);
+  SecAddSharedWebCredential(fqdn, account, password, ^(CFErrorRef error) {
+    if (error != NULL) {
+      result = (CFErrorRef)CFRetain(error);
+    }
+    dispatch_semaphore_signal(done);
+  });
+  dispatch_semaphore_wait(done, DISPATCH_TIME_FOREVER);
+  dispatch_release(done);
+  return result;
+}
+
+CFArrayRef SharedWebCredentialRequest(CFStringRef fqdn, CFStringRef account, CFErrorRef *error) {
+  __block CFArrayRef result = NULL;
+  __block CFErrorRef resultError = NULL;
+  dispatch_semaphore_t done = dispatch_semaphore_create(0);
+  SecRequestSharedWebCredential(fqdn, account, ^(CFArrayRef credentials, CFErrorRef err) {
+    if (err != NULL) {
+      resultError = (CFErrorRef)CFRetain(err);
+    } else if (credentials != NULL) {
+      result = (CFArrayRef)CFRetain(credentials);
+    }
+    dispatch_semaphore_signal(done);
+  });
+  dispatch_semaphore_wait(done, DISPATCH_TIME_FOREVER);
+  dispatch_release(done);
+  *error = resultError;
+  return result;
+}
@@ -0,0 +1,123 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// StoreChunked stores data split across items of at most chunkSize bytes,
+// for keychains that handle large items poorly. item is the template for
+// the stored items and must have an account: a manifest with the length
+// and checksum of data is stored as the item's data, and each chunk is
+// stored in a copy of item with the account suffixed with the chunk index.
+// Use LoadChunked to read the data and DeleteChunked to delete it.
+func StoreChunked(item Item, data []byte, chunkSize int) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	account, ok := item.attr[AccountKey].(string)
+	if !ok {
+		return fmt.Errorf("chunked items require an account")
+	}
+	oldCount := 0
+	if old, err := loadChunkManifest(item); err == nil {
+		oldCount = old.count
+	}
+
+	chunks := splitChunks(data, chunkSize)
+	for i, chunk := range chunks {
+		chunkItem := item.clone()
+		chunkItem.SetAccount(chunkAccount(account, i))
+		chunkItem.SetData(chunk)
+		if err := UpsertItem(chunkItem); err != nil {
+			return err
+		}
+	}
+	manifestItem := item.clone()
+	manifestItem.SetData(newChunkManifest(data, chunkSize).encode())
+	if err := UpsertItem(manifestItem); err != nil {
+		return err
+	}
+	return deleteChunks(item, account, len(chunks), oldCount)
+}
+
+// LoadChunked returns the data stored with StoreChunked for the item matching
+// query, verifying its length and checksum. Returns ErrorItemNotFound if no
+// item matches.
+func LoadChunked(query Item) ([]byte, error) {
+	account, ok := query.attr[AccountKey].(string)
+	if !ok {
+		return nil, fmt.Errorf("chunked items require an account")
+	}
+	m, err := loadChunkManifest(query)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, m.length)
+	for i := 0; i < m.count; i++ {
+		q := chunkQuery(query)
+		q.SetAccount(chunkAccount(account, i))
+		err := BorrowItemData(q, func(chunk []byte) error {
+			data = append(data, chunk...)
+			return nil
+		})
+		if err != nil {
+			Wipe(data)
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+	}
+	if err := m.verify(data); err != nil {
+		Wipe(data)
+		return nil, err
+	}
+	return data, nil
+}
+
+// DeleteChunked deletes the item and chunks stored with StoreChunked.
+func DeleteChunked(item Item) error {
+	account, ok := item.attr[AccountKey].(string)
+	if !ok {
+		return fmt.Errorf("chunked items require an account")
+	}
+	m, err := loadChunkManifest(item)
+	if err != nil {
+		return err
+	}
+	if err := deleteChunks(item, account, 0, m.count); err != nil {
+		return err
+	}
+	return DeleteItem(chunkQuery(item))
+}
+
+// chunkQuery returns a query for the item matching the template.
+func chunkQuery(item Item) Item {
+	q := item.clone()
+	delete(q.attr, DataKey)
+	return q
+}
+
+func loadChunkManifest(item Item) (chunkManifest, error) {
+	var m chunkManifest
+	err := BorrowItemData(chunkQuery(item), func(data []byte) error {
+		var err error
+		m, err = decodeChunkManifest(data)
+		return err
+	})
+	return m, err
+}
+
+// deleteChunks deletes the chunks of account with indexes from start up to
+// end.
+func deleteChunks(item Item, account string, start, end int) error {
+	for i := start; i < end; i++ {
+		q := chunkQuery(item)
+		q.SetAccount(chunkAccount(account, i))
+		if err := DeleteItem(q); err != nil && !errors.Is(err, ErrorItemNotFound) {
+			return err
+		}
+	}
+	return nil
+}
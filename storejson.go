@@ -0,0 +1,25 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+// StoreJSON encodes v with EncodeJSON and stores it as the data of item,
+// adding the item or updating it if it already exists.
+func StoreJSON(item Item, v interface{}) error {
+	data, err := EncodeJSON(v)
+	if err != nil {
+		return err
+	}
+	defer Wipe(data)
+	item = item.clone()
+	item.SetData(data)
+	return UpsertItem(item)
+}
+
+// LoadJSON decodes the data of the item matching query into v with
+// DecodeJSON. Returns ErrorItemNotFound if no item matches.
+func LoadJSON(query Item, v interface{}) error {
+	return BorrowItemData(query, func(data []byte) error {
+		return DecodeJSON(data, v)
+	})
+}
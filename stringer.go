@@ -0,0 +1,79 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var secClassNames = map[SecClass]string{
+	SecClassGenericPassword:  "GenericPassword",
+	SecClassInternetPassword: "InternetPassword",
+	SecClassCertificate:      "Certificate",
+	SecClassCryptoKey:        "CryptoKey",
+	SecClassIdentity:         "Identity",
+}
+
+func (sc SecClass) String() string {
+	if name, ok := secClassNames[sc]; ok {
+		return name
+	}
+	return fmt.Sprintf("SecClass(%d)", int(sc))
+}
+
+// String describes the item's class and identifying attributes. Data is
+// redacted, so items can be logged safely.
+func (k Item) String() string {
+	var parts []string
+	if sc, ok := k.secClass(); ok {
+		parts = append(parts, "class="+sc.String())
+	}
+	for _, f := range []struct{ name, key string }{
+		{"service", ServiceKey},
+		{"server", ServerKey},
+		{"account", AccountKey},
+		{"label", LabelKey},
+		{"created", CreationDateKey},
+		{"modified", ModificationDateKey},
+		{"data", DataKey},
+	} {
+		if v, ok := k.attr[f.key]; ok {
+			parts = append(parts, f.name+"="+debugValue(f.key, v))
+		}
+	}
+	return "Item{" + strings.Join(parts, " ") + "}"
+}
+
+// String describes the result's identifying attributes and dates. Data is
+// redacted, so results can be logged safely.
+func (r QueryResult) String() string {
+	var parts []string
+	for _, f := range []struct{ name, value string }{
+		{"service", r.Service},
+		{"server", r.Server},
+		{"account", r.Account},
+		{"label", r.Label},
+	} {
+		if f.value != "" {
+			parts = append(parts, fmt.Sprintf("%s=%q", f.name, f.value))
+		}
+	}
+	for _, f := range []struct {
+		name  string
+		value time.Time
+	}{
+		{"created", r.CreationDate},
+		{"modified", r.ModificationDate},
+	} {
+		if !f.value.IsZero() {
+			parts = append(parts, f.name+"="+f.value.Format(time.RFC3339))
+		}
+	}
+	if r.Data != nil {
+		parts = append(parts, "data="+debugValue(DataKey, r.Data))
+	}
+	return "QueryResult{" + strings.Join(parts, " ") + "}"
+}
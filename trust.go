@@ -0,0 +1,383 @@
+//go:build darwin
+// +build darwin
+
+package keychain
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security
+
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+*/
+import "C"
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// Policy wraps a SecPolicyRef used for trust evaluation. The underlying
+// reference is released when the Policy is garbage collected.
+type Policy struct {
+	ref C.SecPolicyRef
+}
+
+func newPolicy(ref C.SecPolicyRef) *Policy {
+	trackCF(C.CFTypeRef(ref))
+	p := &Policy{ref: ref}
+	runtime.SetFinalizer(p, func(p *Policy) {
+		Release(C.CFTypeRef(p.ref))
+	})
+	return p
+}
+
+// Close releases the underlying reference instead of waiting for the Policy
+// to be garbage collected. It's safe to call more than once, but the Policy
+// must not be used after it's closed.
+func (p *Policy) Close() {
+	if p.ref == 0 {
+		return
+	}
+	runtime.SetFinalizer(p, nil)
+	Release(C.CFTypeRef(p.ref))
+	p.ref = 0
+}
+
+// Convert returns a retained reference to the policy, so a Policy can be
+// used as an Item attribute value.
+func (p *Policy) Convert() (C.CFTypeRef, error) {
+	return C.CFRetain(C.CFTypeRef(p.ref)), nil
+}
+
+// NewBasicX509Policy returns the basic X.509 certificate policy.
+func NewBasicX509Policy() (*Policy, error) {
+	ref := C.SecPolicyCreateBasicX509()
+	if ref == 0 {
+		return nil, fmt.Errorf("SecPolicyCreateBasicX509 failed")
+	}
+	return newPolicy(ref), nil
+}
+
+// NewSSLPolicy returns the SSL policy. If server is true the policy
+// evaluates server certificates, otherwise client certificates. If hostname
+// is not empty, the leaf certificate must match it.
+func NewSSLPolicy(server bool, hostname string) (*Policy, error) {
+	var cfHostname C.CFStringRef
+	if hostname != "" {
+		var err error
+		cfHostname, err = StringToCFString(hostname)
+		if err != nil {
+			return nil, err
+		}
+		defer Release(C.CFTypeRef(cfHostname))
+	}
+	var cfServer C.Boolean = C.false
+	if server {
+		cfServer = C.true
+	}
+	ref := C.SecPolicyCreateSSL(cfServer, cfHostname)
+	if ref == 0 {
+		return nil, fmt.Errorf("SecPolicyCreateSSL failed")
+	}
+	return newPolicy(ref), nil
+}
+
+// PolicyIdentifier identifies a policy for NewPolicy
+type PolicyIdentifier int
+
+const (
+	// PolicyX509Basic is for kSecPolicyAppleX509Basic
+	PolicyX509Basic PolicyIdentifier = 1
+	// PolicySSL is for kSecPolicyAppleSSL
+	PolicySSL = 2
+	// PolicySMIME is for kSecPolicyAppleSMIME
+	PolicySMIME = 3
+	// PolicyEAP is for kSecPolicyAppleEAP
+	PolicyEAP = 4
+	// PolicyIPsec is for kSecPolicyAppleIPsec
+	PolicyIPsec = 5
+	// PolicyTimeStamping is for kSecPolicyAppleTimeStamping
+	PolicyTimeStamping = 6
+)
+
+var policyIdentifierTypeRef = map[PolicyIdentifier]C.CFTypeRef{
+	PolicyX509Basic:    C.CFTypeRef(C.kSecPolicyAppleX509Basic),
+	PolicySSL:          C.CFTypeRef(C.kSecPolicyAppleSSL),
+	PolicySMIME:        C.CFTypeRef(C.kSecPolicyAppleSMIME),
+	PolicyEAP:          C.CFTypeRef(C.kSecPolicyAppleEAP),
+	PolicyIPsec:        C.CFTypeRef(C.kSecPolicyAppleIPsec),
+	PolicyTimeStamping: C.CFTypeRef(C.kSecPolicyAppleTimeStamping),
+}
+
+var (
+	// PolicyNameKey is for kSecPolicyName
+	PolicyNameKey = attrKey(C.CFTypeRef(C.kSecPolicyName))
+	// PolicyClientKey is for kSecPolicyClient
+	PolicyClientKey = attrKey(C.CFTypeRef(C.kSecPolicyClient))
+)
+
+// NewPolicy returns the policy for identifier. The name is the host name
+// (SSL, EAP, IPsec) or email address (S/MIME) to match, if not empty. If
+// client is true, the policy evaluates client instead of server
+// certificates.
+func NewPolicy(identifier PolicyIdentifier, name string, client bool) (*Policy, error) {
+	id, ok := policyIdentifierTypeRef[identifier]
+	if !ok {
+		return nil, fmt.Errorf("unknown policy identifier %d", identifier)
+	}
+	properties := map[string]interface{}{}
+	if name != "" {
+		properties[PolicyNameKey] = name
+	}
+	if client {
+		properties[PolicyClientKey] = true
+	}
+	cfProperties, err := ConvertMapToCFDictionary(properties)
+	if err != nil {
+		return nil, err
+	}
+	defer Release(C.CFTypeRef(cfProperties))
+	ref := C.SecPolicyCreateWithProperties(id, cfProperties)
+	if ref == 0 {
+		return nil, fmt.Errorf("SecPolicyCreateWithProperties failed")
+	}
+	return newPolicy(ref), nil
+}
+
+// RevocationFlags controls revocation checking during trust evaluation
+type RevocationFlags uint
+
+const (
+	// RevocationOCSPMethod is for kSecRevocationOCSPMethod
+	RevocationOCSPMethod RevocationFlags = C.kSecRevocationOCSPMethod
+	// RevocationCRLMethod is for kSecRevocationCRLMethod
+	RevocationCRLMethod RevocationFlags = C.kSecRevocationCRLMethod
+	// RevocationPreferCRL is for kSecRevocationPreferCRL
+	RevocationPreferCRL RevocationFlags = C.kSecRevocationPreferCRL
+	// RevocationRequirePositiveResponse is for kSecRevocationRequirePositiveResponse
+	RevocationRequirePositiveResponse RevocationFlags = C.kSecRevocationRequirePositiveResponse
+	// RevocationNetworkAccessDisabled is for kSecRevocationNetworkAccessDisabled
+	RevocationNetworkAccessDisabled RevocationFlags = C.kSecRevocationNetworkAccessDisabled
+	// RevocationUseAnyAvailableMethod is for kSecRevocationUseAnyAvailableMethod
+	RevocationUseAnyAvailableMethod RevocationFlags = C.kSecRevocationUseAnyAvailableMethod
+)
+
+// NewRevocationPolicy returns a policy that checks the revocation status of
+// certificates using the methods in flags.
+func NewRevocationPolicy(flags RevocationFlags) (*Policy, error) {
+	ref := C.SecPolicyCreateRevocation(C.CFOptionFlags(flags))
+	if ref == 0 {
+		return nil, fmt.Errorf("SecPolicyCreateRevocation failed")
+	}
+	return newPolicy(ref), nil
+}
+
+// TrustRef wraps a SecTrustRef. The underlying reference is released when
+// the TrustRef is garbage collected.
+type TrustRef struct {
+	ref C.SecTrustRef
+}
+
+func certificatesToCFArray(certs []*CertificateRef) C.CFArrayRef {
+	refs := make([]C.CFTypeRef, 0, len(certs))
+	for _, cert := range certs {
+		refs = append(refs, C.CFTypeRef(cert.ref))
+	}
+	return ArrayToCFArray(refs)
+}
+
+// NewTrustRef creates a trust object for evaluating certs with policies.
+// The first certificate is the one being evaluated, the rest may be used to
+// build the chain.
+func NewTrustRef(certs []*CertificateRef, policies ...*Policy) (*TrustRef, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates to evaluate")
+	}
+	cfCerts := certificatesToCFArray(certs)
+	defer Release(C.CFTypeRef(cfCerts))
+
+	policyRefs := make([]C.CFTypeRef, 0, len(policies))
+	for _, policy := range policies {
+		policyRefs = append(policyRefs, C.CFTypeRef(policy.ref))
+	}
+	cfPolicies := ArrayToCFArray(policyRefs)
+	defer Release(C.CFTypeRef(cfPolicies))
+
+	var ref C.SecTrustRef
+	errCode := C.SecTrustCreateWithCertificates(C.CFTypeRef(cfCerts), C.CFTypeRef(cfPolicies), &ref) //nolint
+	if err := checkOpError("SecTrustCreateWithCertificates", errCode); err != nil {
+		return nil, err
+	}
+	trackCF(C.CFTypeRef(ref))
+	t := &TrustRef{ref: ref}
+	runtime.SetFinalizer(t, func(t *TrustRef) {
+		Release(C.CFTypeRef(t.ref))
+	})
+	return t, nil
+}
+
+// Close releases the underlying reference instead of waiting for the
+// TrustRef to be garbage collected. It's safe to call more than once, but
+// the TrustRef must not be used after it's closed.
+func (t *TrustRef) Close() {
+	if t.ref == 0 {
+		return
+	}
+	runtime.SetFinalizer(t, nil)
+	Release(C.CFTypeRef(t.ref))
+	t.ref = 0
+}
+
+// SetAnchorCertificates sets the certificates trusted as anchors. Unless
+// SetAnchorCertificatesOnly(false) is called afterwards, the system anchors
+// are no longer trusted.
+func (t *TrustRef) SetAnchorCertificates(anchors []*CertificateRef) error {
+	cfAnchors := certificatesToCFArray(anchors)
+	defer Release(C.CFTypeRef(cfAnchors))
+	return checkOpError("SecTrustSetAnchorCertificates", C.SecTrustSetAnchorCertificates(t.ref, cfAnchors))
+}
+
+// SetAnchorCertificatesOnly sets whether only the anchors set with
+// SetAnchorCertificates are trusted, or the system anchors as well.
+func (t *TrustRef) SetAnchorCertificatesOnly(only bool) error {
+	var cfOnly C.Boolean = C.false
+	if only {
+		cfOnly = C.true
+	}
+	return checkOpError("SecTrustSetAnchorCertificatesOnly", C.SecTrustSetAnchorCertificatesOnly(t.ref, cfOnly))
+}
+
+// SetNetworkFetchAllowed sets whether evaluation may fetch missing
+// intermediate certificates and revocation information from the network.
+func (t *TrustRef) SetNetworkFetchAllowed(allowed bool) error {
+	var cfAllowed C.Boolean = C.false
+	if allowed {
+		cfAllowed = C.true
+	}
+	return checkOpError("SecTrustSetNetworkFetchAllowed", C.SecTrustSetNetworkFetchAllowed(t.ref, cfAllowed))
+}
+
+// SetVerifyDate sets the date at which the certificates are evaluated,
+// instead of the current date.
+func (t *TrustRef) SetVerifyDate(date time.Time) error {
+	cfDate := TimeToCFDate(date)
+	defer Release(C.CFTypeRef(cfDate))
+	return checkOpError("SecTrustSetVerifyDate", C.SecTrustSetVerifyDate(t.ref, cfDate))
+}
+
+// Evaluate evaluates the trust object, returning an error if the
+// certificate is not trusted.
+func (t *TrustRef) Evaluate() error {
+	var cfErr C.CFErrorRef
+	if C.SecTrustEvaluateWithError(t.ref, &cfErr) { //nolint
+		return nil
+	}
+	if cfErr == 0 {
+		return fmt.Errorf("SecTrustEvaluateWithError failed")
+	}
+	defer Release(C.CFTypeRef(cfErr))
+	return CFErrorError(cfErr)
+}
+
+// CertificateChain returns the certificate chain built by Evaluate, leaf
+// first.
+func (t *TrustRef) CertificateChain() []*CertificateRef {
+	count := C.SecTrustGetCertificateCount(t.ref)
+	chain := make([]*CertificateRef, 0, count)
+	for i := C.CFIndex(0); i < count; i++ {
+		chain = append(chain, newCertificateRef(C.SecTrustGetCertificateAtIndex(t.ref, i)))
+	}
+	return chain
+}
+
+// NetworkFetch is whether trust evaluation may use the network
+type NetworkFetch int
+
+const (
+	// NetworkFetchDefault uses the Security framework default for the policy
+	NetworkFetchDefault NetworkFetch = 0
+	// NetworkFetchAllowed allows network access
+	NetworkFetchAllowed = 1
+	// NetworkFetchDisallowed forces offline evaluation
+	NetworkFetchDisallowed = 2
+)
+
+// TrustOptions configures EvaluateCertChain.
+type TrustOptions struct {
+	// SSL evaluates with the SSL policy instead of the basic X.509 policy
+	SSL bool
+	// SSLClient evaluates a client certificate instead of a server certificate
+	SSLClient bool
+	// Hostname the server certificate must match when SSL is set
+	Hostname string
+	// Revocation enables revocation checking if not zero
+	Revocation RevocationFlags
+	// VerifyDate evaluates the chain at this date instead of now if not zero
+	VerifyDate time.Time
+	// Anchors are trusted in addition to the system anchors
+	Anchors []*CertificateRef
+	// AnchorsOnly trusts only Anchors and not the system anchors
+	AnchorsOnly bool
+	// NetworkFetch controls fetching of intermediates and revocation information
+	NetworkFetch NetworkFetch
+	// Policies are evaluated in addition to the SSL or basic X.509 policy
+	Policies []*Policy
+}
+
+func (opts TrustOptions) policies() ([]*Policy, error) {
+	var policy *Policy
+	var err error
+	if opts.SSL {
+		policy, err = NewSSLPolicy(!opts.SSLClient, opts.Hostname)
+	} else {
+		policy, err = NewBasicX509Policy()
+	}
+	if err != nil {
+		return nil, err
+	}
+	policies := append([]*Policy{policy}, opts.Policies...)
+	if opts.Revocation != 0 {
+		revocation, err := NewRevocationPolicy(opts.Revocation)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, revocation)
+	}
+	return policies, nil
+}
+
+// EvaluateCertChain evaluates certs (leaf first) against the system trust
+// settings and returns the resulting certificate chain.
+func EvaluateCertChain(certs []*CertificateRef, opts TrustOptions) ([]*CertificateRef, error) {
+	policies, err := opts.policies()
+	if err != nil {
+		return nil, err
+	}
+	trust, err := NewTrustRef(certs, policies...)
+	if err != nil {
+		return nil, err
+	}
+	defer trust.Close()
+	if len(opts.Anchors) > 0 || opts.AnchorsOnly {
+		if err := trust.SetAnchorCertificates(opts.Anchors); err != nil {
+			return nil, err
+		}
+		if err := trust.SetAnchorCertificatesOnly(opts.AnchorsOnly); err != nil {
+			return nil, err
+		}
+	}
+	if opts.NetworkFetch != NetworkFetchDefault {
+		if err := trust.SetNetworkFetchAllowed(opts.NetworkFetch == NetworkFetchAllowed); err != nil {
+			return nil, err
+		}
+	}
+	if !opts.VerifyDate.IsZero() {
+		if err := trust.SetVerifyDate(opts.VerifyDate); err != nil {
+			return nil, err
+		}
+	}
+	if err := trust.Evaluate(); err != nil {
+		return nil, err
+	}
+	return trust.CertificateChain(), nil
+}
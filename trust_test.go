@@ -0,0 +1,50 @@
+//go:build darwin && !ios
+// +build darwin,!ios
+
+package keychain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateCertChainAnchorsOnly(t *testing.T) {
+	cert, err := NewCertificateRef(testCertificateDER(t))
+	require.NoError(t, err)
+	verifyDate := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err = EvaluateCertChain([]*CertificateRef{cert}, TrustOptions{VerifyDate: verifyDate})
+	require.Error(t, err)
+	var cfErr *CFError
+	require.True(t, errors.As(err, &cfErr))
+	require.NotEmpty(t, cfErr.Domain)
+	require.NotZero(t, cfErr.Code)
+
+	chain, err := EvaluateCertChain([]*CertificateRef{cert}, TrustOptions{
+		VerifyDate:  verifyDate,
+		Anchors:     []*CertificateRef{cert},
+		AnchorsOnly: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, chain, 1)
+
+	_, err = EvaluateCertChain([]*CertificateRef{cert}, TrustOptions{
+		VerifyDate:  time.Date(2035, 1, 1, 0, 0, 0, 0, time.UTC),
+		Anchors:     []*CertificateRef{cert},
+		AnchorsOnly: true,
+	})
+	require.Error(t, err)
+}
+
+func TestTrustCopyAnchorCertificates(t *testing.T) {
+	anchors, err := TrustCopyAnchorCertificates()
+	require.NoError(t, err)
+	require.NotEmpty(t, anchors)
+
+	data, err := CertificatesData(anchors)
+	require.NoError(t, err)
+	require.Len(t, data, len(anchors))
+}
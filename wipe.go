@@ -0,0 +1,15 @@
+package keychain
+
+import "runtime"
+
+// Wipe overwrites b with zeros, e.g. to clear a password returned by
+// GetGenericPassword once it's no longer needed. Data returned by
+// GetGenericPassword, or by QueryItem with SetReturnWipeableData, is the only
+// copy of the plaintext in Go memory, so wiping it removes the plaintext from
+// the Go heap.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+}
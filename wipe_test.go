@@ -0,0 +1,14 @@
+package keychain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWipe(t *testing.T) {
+	b := []byte("toomanysecrets")
+	Wipe(b)
+	require.Equal(t, make([]byte, len("toomanysecrets")), b)
+	Wipe(nil)
+}